@@ -205,7 +205,7 @@ export default function GRPCUIFrontend() {
 
   const sendEndSignal = () => {
     if (wsConnection) {
-      wsConnection.send('__END__');
+      wsConnection.send(JSON.stringify({ '@control': 'half-close' }));
       setStreamMessages(prev => [...prev, { type: 'system', content: 'End signal sent' }]);
     }
   };
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile/ast"
+	"github.com/bufbuild/protocompile/parser"
+	"github.com/bufbuild/protocompile/reporter"
+)
+
+// Archive extraction limits
+const (
+	MaxArchiveEntries = 10000
+	MaxExtractedBytes = 64 << 20
+)
+
+// Log messages as variables
+var (
+	MsgUnsupportedUpload = "unsupported upload type: %s"
+	MsgUnsafeArchivePath = "unsafe path in archive: %s"
+	MsgArchiveTooLarge   = "archive exceeds extraction limits"
+	MsgNoProtoFiles      = "No .proto files found in upload"
+)
+
+var ErrNoProtoFiles = errors.New("no .proto files found in upload")
+
+// storeUpload saves a single multipart upload into userDir, unpacking zip and
+// tar(.gz) archives in place. Only .proto entries are kept from archives.
+// written counts the bytes stored so far across all parts of the request.
+func storeUpload(file *multipart.FileHeader, userDir string, written *int64) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	name := strings.ToLower(file.Filename)
+	switch {
+	case strings.HasSuffix(name, ".proto"):
+		return writeUploadEntry(userDir, uploadPath(file), src, written)
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(src, file.Size, userDir, written)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, userDir, written)
+	case strings.HasSuffix(name, ".tar"):
+		return extractTar(src, userDir, written)
+	default:
+		return fmt.Errorf(MsgUnsupportedUpload, file.Filename)
+	}
+}
+
+// uploadPath is the name a part was sent with, directories included, so
+// that loose files keep their import paths. multipart reduces Filename to
+// its base name, hence the raw Content-Disposition is read first.
+func uploadPath(file *multipart.FileHeader) string {
+	_, params, err := mime.ParseMediaType(file.Header.Get("Content-Disposition"))
+	if name := params["filename"]; err == nil && name != "" {
+		return name
+	}
+	return file.Filename
+}
+
+func extractZip(src io.ReaderAt, size int64, userDir string, written *int64) error {
+	r, err := zip.NewReader(src, size)
+	if err != nil {
+		return err
+	}
+
+	if len(r.File) > MaxArchiveEntries {
+		return errors.New(MsgArchiveTooLarge)
+	}
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() || !isProtoFile(f.Name) {
+			continue
+		}
+
+		if err := extractZipEntry(f, userDir, written); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipEntry(f *zip.File, userDir string, written *int64) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return writeUploadEntry(userDir, f.Name, rc, written)
+}
+
+func extractTar(src io.Reader, userDir string, written *int64) error {
+	tr := tar.NewReader(src)
+
+	for entries := 0; ; entries++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if entries >= MaxArchiveEntries {
+			return errors.New(MsgArchiveTooLarge)
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !isProtoFile(hdr.Name) {
+			continue
+		}
+
+		if err := writeUploadEntry(userDir, hdr.Name, tr, written); err != nil {
+			return err
+		}
+	}
+}
+
+// writeUploadEntry copies src to name beneath userDir, refusing entries that
+// would escape it and enforcing MaxExtractedBytes across the whole upload.
+func writeUploadEntry(userDir, name string, src io.Reader, written *int64) error {
+	rel, err := safeRelativePath(name)
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(userDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, io.LimitReader(src, MaxExtractedBytes-*written+1))
+	*written += n
+	if err != nil {
+		return err
+	}
+
+	if *written > MaxExtractedBytes {
+		return errors.New(MsgArchiveTooLarge)
+	}
+	return nil
+}
+
+func safeRelativePath(name string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." ||
+		strings.HasPrefix(cleaned, "../") || filepath.VolumeName(cleaned) != "" {
+		return "", fmt.Errorf(MsgUnsafeArchivePath, name)
+	}
+	return filepath.FromSlash(cleaned), nil
+}
+
+func isProtoFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".proto")
+}
+
+// collectProtoTree lists every .proto file under userDir and works out the
+// import roots needed to resolve them. It returns the roots (deepest first)
+// and each file's name relative to the deepest root containing it.
+func collectProtoTree(userDir string) ([]string, []string, error) {
+	var files []string
+	err := filepath.WalkDir(userDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isProtoFile(p) {
+			return err
+		}
+
+		rel, err := filepath.Rel(userDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, nil, ErrNoProtoFiles
+	}
+
+	roots := detectImportRoots(userDir, files)
+
+	names := make([]string, 0, len(files))
+	seen := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		name := nameUnderRoots(file, roots)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+
+	dirs := make([]string, len(roots))
+	for i, root := range roots {
+		dirs[i] = filepath.Join(userDir, filepath.FromSlash(root))
+	}
+	return dirs, names, nil
+}
+
+// detectImportRoots infers import roots from the import statements: a file
+// at a/b/c.proto that is imported as "b/c.proto" implies the root "a". The
+// upload directory itself is always the last root.
+func detectImportRoots(userDir string, files []string) []string {
+	rootSet := map[string]struct{}{"": {}}
+
+	for _, file := range files {
+		for _, imp := range readImports(filepath.Join(userDir, filepath.FromSlash(file))) {
+			for _, candidate := range files {
+				if root, ok := strings.CutSuffix(candidate, "/"+imp); ok {
+					rootSet[root] = struct{}{}
+				}
+			}
+		}
+	}
+
+	roots := make([]string, 0, len(rootSet))
+	for root := range rootSet {
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		if len(roots[i]) != len(roots[j]) {
+			return len(roots[i]) > len(roots[j])
+		}
+		return roots[i] < roots[j]
+	})
+	return roots
+}
+
+func nameUnderRoots(file string, roots []string) string {
+	for _, root := range roots {
+		if root == "" {
+			return file
+		}
+		if rel, ok := strings.CutPrefix(file, root+"/"); ok {
+			return rel
+		}
+	}
+	return file
+}
+
+// readImports returns the files imported by the proto file at p. The file
+// is parsed rather than scanned, so imports sharing a line with other
+// statements or split across lines are found and commented-out ones are
+// not. Syntax errors are left for the compiler to report.
+func readImports(p string) []string {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	ignore := reporter.NewReporter(func(reporter.ErrorWithPos) error { return nil }, nil)
+	file, _ := parser.Parse(filepath.Base(p), f, reporter.NewHandler(ignore))
+	if file == nil {
+		return nil
+	}
+
+	var imports []string
+	for _, decl := range file.Decls {
+		if imp, ok := decl.(*ast.ImportNode); ok {
+			imports = append(imports, imp.Name.AsString())
+		}
+	}
+	return imports
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// uploadParts encodes files as the "proto" parts of a multipart form and
+// parses them back, as the upload handler receives them.
+func uploadParts(t *testing.T, files ...[2]string) []*multipart.FileHeader {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := w.CreateFormFile("proto", file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file[1]))
+	}
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["proto"]
+}
+
+func zipArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func tarArchive(t *testing.T, gzipped bool, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	out := io.Writer(&buf)
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		out = gz
+	}
+
+	w := tar.NewWriter(out)
+	for name, data := range files {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		gz.Close()
+	}
+	return buf.String()
+}
+
+// storedFiles lists the files under dir, slash-separated and sorted.
+func storedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(files)
+	return files
+}
+
+func TestStoreUpload(t *testing.T) {
+	contents := map[string]string{
+		"protos/a.proto":   `syntax = "proto3";`,
+		"protos/b/c.proto": `syntax = "proto3";`,
+		"README.md":        "not a proto",
+	}
+	want := []string{"protos/a.proto", "protos/b/c.proto"}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"api.zip", zipArchive(t, contents)},
+		{"api.tar", tarArchive(t, false, contents)},
+		{"api.tar.gz", tarArchive(t, true, contents)},
+		{"api.tgz", tarArchive(t, true, contents)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var written int64
+			if err := storeUpload(uploadParts(t, [2]string{tt.name, tt.data})[0], dir, &written); err != nil {
+				t.Fatal(err)
+			}
+			if got := storedFiles(t, dir); !slices.Equal(got, want) {
+				t.Fatalf("stored %v, want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("loose files keep their paths", func(t *testing.T) {
+		dir := t.TempDir()
+		var written int64
+		for _, part := range uploadParts(t, [2]string{"protos/a.proto", "a"}, [2]string{"protos/b/c.proto", "c"}) {
+			if err := storeUpload(part, dir, &written); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := storedFiles(t, dir); !slices.Equal(got, want) {
+			t.Fatalf("stored %v, want %v", got, want)
+		}
+		if written != 2 {
+			t.Fatalf("written = %d, want 2", written)
+		}
+	})
+}
+
+func TestStoreUploadRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"../evil.proto", "a/../../evil.proto", "/etc/evil.proto", `..\evil.proto`} {
+		for _, upload := range [][2]string{
+			{"evil.zip", zipArchive(t, map[string]string{name: "x"})},
+			{"evil.tar", tarArchive(t, false, map[string]string{name: "x"})},
+		} {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "upload")
+
+			var written int64
+			err := storeUpload(uploadParts(t, upload)[0], dir, &written)
+			if err == nil || err.Error() != fmt.Sprintf(MsgUnsafeArchivePath, name) {
+				t.Errorf("%s %s: error %v", upload[0], name, err)
+			}
+			if got := storedFiles(t, parent); len(got) != 0 {
+				t.Errorf("%s %s: stored %v", upload[0], name, got)
+			}
+		}
+	}
+}
+
+func TestStoreUploadLimits(t *testing.T) {
+	entries := make(map[string]string, MaxArchiveEntries+1)
+	for i := 0; i <= MaxArchiveEntries; i++ {
+		entries[fmt.Sprintf("e%d.proto", i)] = ""
+	}
+
+	for _, upload := range [][2]string{
+		{"many.zip", zipArchive(t, entries)},
+		{"many.tar", tarArchive(t, false, entries)},
+	} {
+		var written int64
+		err := storeUpload(uploadParts(t, upload)[0], t.TempDir(), &written)
+		if err == nil || err.Error() != MsgArchiveTooLarge {
+			t.Errorf("%s: error %v", upload[0], err)
+		}
+	}
+
+	// The byte budget is shared by every part of a request, loose files and
+	// archives alike.
+	for _, upload := range [][2]string{
+		{"big.proto", "0123456789"},
+		{"big.zip", zipArchive(t, map[string]string{"a.proto": "0123456789"})},
+		{"big.tar", tarArchive(t, false, map[string]string{"a.proto": "0123456789"})},
+	} {
+		written := int64(MaxExtractedBytes - 5)
+		err := storeUpload(uploadParts(t, upload)[0], t.TempDir(), &written)
+		if err == nil || err.Error() != MsgArchiveTooLarge {
+			t.Errorf("%s: error %v", upload[0], err)
+		}
+	}
+}
+
+func TestReadImports(t *testing.T) {
+	src := `syntax = "proto3"; import "a.proto"; import public "b.proto";
+// import "commented.proto";
+/* import "blocked.proto"; */
+import
+  weak "c/d.proto";
+message M { string s = 1; }
+`
+	p := filepath.Join(t.TempDir(), "m.proto")
+	if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a.proto", "b.proto", "c/d.proto"}
+	if got := readImports(p); !slices.Equal(got, want) {
+		t.Fatalf("imports %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(p, []byte(`import "a.proto"; message {`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readImports(p); !slices.Equal(got, []string{"a.proto"}) {
+		t.Fatalf("imports with a syntax error %v", got)
+	}
+}
@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type FrameType string
+
+// Frame types written back to the client, in call order: header, zero or
+// more messages, trailer, status. Error frames report problems on our side
+// (bad input, unknown method) rather than a gRPC status.
+const (
+	FrameHeader  FrameType = "header"
+	FrameMessage FrameType = "message"
+	FrameTrailer FrameType = "trailer"
+	FrameStatus  FrameType = "status"
+	FrameError   FrameType = "error"
+)
+
+// Control frames are JSON objects carrying an "@control" key. Proto3 JSON
+// reserves "@"-prefixed keys (as in Any's "@type"), so a control frame can
+// never be mistaken for a request message.
+const (
+	ControlKey       = "@control"
+	ControlCancel    = "cancel"
+	ControlHalfClose = "half-close"
+	ControlGrant     = "grant"
+)
+
+// LegacyHalfClose is the bare-text half-close sent by older UI builds. It is
+// still honoured on a single-call connection, where it cannot be confused
+// with a JSON request message.
+const LegacyHalfClose = "__END__"
+
+// ControlFrame is a client-to-server signal sent in place of a request message.
+type ControlFrame struct {
+	Control string `json:"@control"`
+	Credits int    `json:"credits,omitempty"` // grant
+}
+
+// Frame is one structured message written to the client.
+type Frame struct {
+	Type     FrameType           `json:"type"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+	Message  json.RawMessage     `json:"message,omitempty"`
+	Status   *RPCStatus          `json:"status,omitempty"`
+	Error    string              `json:"error,omitempty"`
+	Details  string              `json:"details,omitempty"`
+	Peer     string              `json:"peer,omitempty"`    // backend address, on status frames
+	Dropped  int                 `json:"dropped,omitempty"` // messages dropped by flow control, on status frames
+}
+
+// RPCStatus is the final gRPC status of a call.
+type RPCStatus struct {
+	Code     codes.Code        `json:"code"`
+	CodeName string            `json:"codeName"`
+	Message  string            `json:"message,omitempty"`
+	Details  []json.RawMessage `json:"details,omitempty"`
+}
+
+// MaxQueuedMessages bounds the request messages waiting for the backend to
+// take them. Beyond it messages are dropped with an error frame rather than
+// stalling the read pump.
+const MaxQueuedMessages = 1024
+
+// rpcCall holds what the stream-mode handlers share for a single call.
+// Frames may be sent from several goroutines (bidi), so writes to conn are
+// serialized here, or queued in the outbox when the call is flow controlled.
+// Reads go through a single pump that never waits on the handler: request
+// messages are queued for readMessage, while control frames and a closed
+// connection take effect at once, even when the handler is stuck in SendMsg
+// behind HTTP/2 flow control.
+type rpcCall struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stub     grpcdynamic.Stub
+	conn     streamConn
+	method   *desc.MethodDescriptor
+	registry *descriptorRegistry
+	peer     peer.Peer // filled in by grpc.Peer once the call completes
+	outbox   *outbox   // nil unless the client asked for flow control
+	jsonOpts *JSONOptions
+	input    PayloadEncoding
+	output   PayloadEncoding
+
+	writeMu  sync.Mutex
+	writeErr error
+
+	inputMu    sync.Mutex
+	inbound    chan []byte // buffered, so the pump never blocks on it
+	inputEnded bool        // inbound is closed: half-close, disconnect or stopInput
+	halfClosed bool        // set by the pump only
+}
+
+// startReading launches the read pump. Request messages are queued for
+// readMessage; control frames are acted on immediately. When the connection
+// goes away the call is cancelled, as nobody is left to see its result.
+func (c *rpcCall) startReading() {
+	c.inbound = make(chan []byte, MaxQueuedMessages)
+
+	go func() {
+		defer c.closeInbound()
+		defer c.cancel()
+
+		for {
+			_, msgRaw, err := c.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if ctl, ok := parseControlFrame(msgRaw); ok {
+				c.handleControl(ctl)
+				continue
+			}
+
+			if c.halfClosed {
+				c.sendError(MsgUnexpectedMessage, "")
+				continue
+			}
+
+			if msg, details := c.queueMessage(msgRaw); msg != "" {
+				c.sendError(msg, details)
+			}
+		}
+	}()
+}
+
+// queueMessage hands msgRaw to readMessage without waiting, and returns the
+// error to report if it cannot.
+func (c *rpcCall) queueMessage(msgRaw []byte) (string, string) {
+	c.inputMu.Lock()
+	defer c.inputMu.Unlock()
+
+	if c.inputEnded {
+		return MsgUnexpectedMessage, ""
+	}
+
+	select {
+	case c.inbound <- msgRaw:
+		return "", ""
+	default:
+		return MsgInputQueueFull, fmt.Sprintf("%d messages pending", MaxQueuedMessages)
+	}
+}
+
+// readMessage returns the next request message, or an error once the
+// client half-closed, the connection is closed or the call is over.
+// Messages queued before a half-close are still delivered.
+func (c *rpcCall) readMessage() ([]byte, error) {
+	select {
+	case msgRaw, ok := <-c.inbound:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msgRaw, nil
+	case <-c.ctx.Done():
+		return nil, c.ctx.Err()
+	}
+}
+
+// stopInput tells the pump the handler will read no more request messages;
+// any that arrive later are answered with an error frame. Messages already
+// queued are discarded, with one error frame unless the call was cancelled.
+func (c *rpcCall) stopInput() {
+	c.closeInbound()
+
+	discarded := 0
+	for range c.inbound {
+		discarded++
+	}
+	if discarded > 0 && c.ctx.Err() == nil {
+		c.sendError(MsgUnexpectedMessage, fmt.Sprintf("%d queued messages not sent", discarded))
+	}
+}
+
+func (c *rpcCall) handleControl(ctl *ControlFrame) {
+	switch ctl.Control {
+	case ControlCancel:
+		c.cancel()
+	case ControlHalfClose:
+		c.halfClosed = true
+		c.closeInbound()
+	case ControlGrant:
+		switch {
+		case c.outbox == nil:
+			c.sendError(MsgFlowNotEnabled, "")
+		case ctl.Credits <= 0:
+			c.sendError(MsgInvalidGrant, "")
+		default:
+			c.outbox.grant(ctl.Credits)
+		}
+	default:
+		c.sendError(MsgUnknownControl, ctl.Control)
+	}
+}
+
+// closeInbound ends the request messages seen by readMessage. Sends happen
+// under inputMu, so closing inbound cannot race one.
+func (c *rpcCall) closeInbound() {
+	c.inputMu.Lock()
+	defer c.inputMu.Unlock()
+
+	if !c.inputEnded {
+		c.inputEnded = true
+		close(c.inbound)
+	}
+}
+
+func parseControlFrame(msgRaw []byte) (*ControlFrame, bool) {
+	if string(msgRaw) == LegacyHalfClose {
+		return &ControlFrame{Control: ControlHalfClose}, true
+	}
+
+	var ctl ControlFrame
+	if err := json.Unmarshal(msgRaw, &ctl); err != nil || ctl.Control == "" {
+		return nil, false
+	}
+	return &ctl, true
+}
+
+// send writes frame, through the outbox if there is one. Error frames are
+// out of band and skip the queue.
+func (c *rpcCall) send(frame *Frame) error {
+	if c.outbox != nil && frame.Type != FrameError {
+		return c.outbox.push(frame)
+	}
+	return c.write(frame)
+}
+
+// write puts frame on the connection. The first failed write stops the
+// call, since nobody can see its results any more.
+func (c *rpcCall) write(frame *Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+
+	if err := c.writeFrame(frame); err != nil {
+		c.writeErr = err
+		c.cancel()
+		return err
+	}
+	return nil
+}
+
+func (c *rpcCall) writeFrame(frame *Frame) error {
+	indent := c.jsonOpts.indent()
+	if indent == "" {
+		return c.conn.WriteJSON(frame)
+	}
+
+	data, err := marshalFrame(frame, indent)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// enableFlowControl queues the call's frames behind credits granted by the
+// client. finish must be called once the handler is done.
+func (c *rpcCall) enableFlowControl(cfg *FlowConfig) {
+	c.outbox = newOutbox(c.ctx, cfg, c.write)
+}
+
+// finish writes out the frames still queued for flow control.
+func (c *rpcCall) finish() {
+	if c.outbox != nil {
+		c.outbox.flush()
+	}
+}
+
+func (c *rpcCall) sendError(msg, details string) error {
+	return c.send(&Frame{Type: FrameError, Error: msg, Details: details})
+}
+
+func (c *rpcCall) sendMessage(data []byte) error {
+	return c.send(&Frame{Type: FrameMessage, Message: data})
+}
+
+func (c *rpcCall) sendHeader(md metadata.MD) error {
+	return c.send(&Frame{Type: FrameHeader, Metadata: md})
+}
+
+func (c *rpcCall) sendTrailer(md metadata.MD) error {
+	return c.send(&Frame{Type: FrameTrailer, Metadata: md})
+}
+
+// sendStatus reports the outcome of the call; a nil err is OK.
+func (c *rpcCall) sendStatus(err error) error {
+	return c.send(&Frame{
+		Type:   FrameStatus,
+		Status: statusFromError(err, c.registry.resolver()),
+		Peer:   peerAddress(&c.peer),
+	})
+}
+
+// statusFromError converts err (nil meaning OK) into a status whose details
+// are decoded with resolver.
+func statusFromError(err error, resolver *typeResolver) *RPCStatus {
+	st := status.Convert(err)
+
+	result := &RPCStatus{
+		Code:     st.Code(),
+		CodeName: code.Code(st.Code()).String(),
+		Message:  st.Message(),
+	}
+
+	for _, detail := range st.Proto().GetDetails() {
+		result.Details = append(result.Details, decodeStatusDetail(detail, resolver))
+	}
+
+	return result
+}
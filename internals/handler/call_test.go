@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const sinkProto = `syntax = "proto3";
+package sink;
+
+message Chunk {
+  bytes data = 1;
+}
+
+service Sink {
+  rpc Upload(stream Chunk) returns (Chunk);
+}
+`
+
+// startSinkServer serves sink.Sink, whose Upload never reads its requests.
+// The returned channels are closed when an Upload starts and once its
+// context is done.
+func startSinkServer(t *testing.T) (string, <-chan struct{}, <-chan struct{}) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fixed window keeps the client's sends blocked once it fills.
+	srv := grpc.NewServer(grpc.InitialWindowSize(64<<10), grpc.InitialConnWindowSize(64<<10))
+	started, done := make(chan struct{}), make(chan struct{})
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "sink.Sink",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Upload",
+			ClientStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				close(started)
+				<-stream.Context().Done()
+				close(done)
+				return stream.Context().Err()
+			},
+		}},
+	}, struct{}{})
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), started, done
+}
+
+func newSinkWorkspace(t *testing.T) *Workspace {
+	return newProtoWorkspace(t, "sink.proto", sinkProto)
+}
+
+func dialCallSocket(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	router := gin.New()
+	router.GET("/grpc/ws/stream", HandleGRPCWebSocketStream)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/grpc/ws/stream"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// The backend below never reads, so the call's sends block on HTTP/2 flow
+// control; a cancel or a dropped connection must still end the call.
+func TestClientStreamCancelWhileBackendStalled(t *testing.T) {
+	chunk := fmt.Sprintf(`{"data":%q}`, base64.StdEncoding.EncodeToString(make([]byte, 15<<10)))
+
+	for name, stop := range map[string]func(*websocket.Conn) error{
+		"cancel frame": func(conn *websocket.Conn) error {
+			return conn.WriteMessage(websocket.TextMessage, []byte(`{"@control":"cancel"}`))
+		},
+		"connection closed": func(conn *websocket.Conn) error {
+			return conn.Close()
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			target, started, done := startSinkServer(t)
+			ws := newSinkWorkspace(t)
+			conn := dialCallSocket(t)
+
+			err := conn.WriteJSON(&InitMessage{
+				Workspace: ws.ID,
+				Target:    target,
+				Service:   "sink.Sink",
+				Method:    "Upload",
+				Mode:      string(ModeClient),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-started:
+			case <-time.After(10 * time.Second):
+				t.Fatal("backend call did not start")
+			}
+
+			for i := 0; i < 20; i++ {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(chunk)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := stop(conn); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("backend call was not cancelled")
+			}
+		})
+	}
+}
+
+// A deadline or cancel that beats the request message ends the call with
+// a status frame, as it would once the RPC had started.
+func TestCallEndsBeforeInput(t *testing.T) {
+	target := startHealthServer(t)
+	ws := newHealthWorkspace(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		mode    StreamMode
+		timeout string
+		cancel  bool
+		code    codes.Code
+	}{
+		{"unary deadline", "Check", ModeUnary, "200ms", false, codes.DeadlineExceeded},
+		{"server stream deadline", "Watch", ModeServer, "200ms", false, codes.DeadlineExceeded},
+		{"unary cancel", "Check", ModeUnary, "", true, codes.Canceled},
+		{"server stream cancel", "Watch", ModeServer, "", true, codes.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialCallSocket(t)
+			err := conn.WriteJSON(&InitMessage{
+				Workspace: ws.ID,
+				Target:    target,
+				Service:   "grpc.health.v1.Health",
+				Method:    tt.method,
+				Mode:      string(tt.mode),
+				Timeout:   tt.timeout,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.cancel {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"@control":"cancel"}`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+			var frame Frame
+			if err := conn.ReadJSON(&frame); err != nil {
+				t.Fatal(err)
+			}
+			if frame.Type != FrameStatus || frame.Status.Code != tt.code {
+				t.Fatalf("frame %+v, want %v status", frame, tt.code)
+			}
+		})
+	}
+}
+
+func TestParseControlFrame(t *testing.T) {
+	tests := []struct {
+		msg     string
+		control string
+	}{
+		{`{"@control":"half-close"}`, ControlHalfClose},
+		{`{"@control":"grant","credits":4}`, ControlGrant},
+		{LegacyHalfClose, ControlHalfClose},
+		{`"__END__"`, ""},
+		{`{"name":"World"}`, ""},
+		{`{"@type":"type.googleapis.com/google.protobuf.Empty"}`, ""},
+	}
+
+	for _, tt := range tests {
+		ctl, ok := parseControlFrame([]byte(tt.msg))
+		if ok != (tt.control != "") || ok && ctl.Control != tt.control {
+			t.Errorf("parseControlFrame(%s) = %+v, %v; want %q", tt.msg, ctl, ok, tt.control)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Collections configuration
+const (
+	DataDirEnv      = "GRPCUI_DATA_DIR"
+	DefaultDataDir  = "./data"
+	CollectionsFile = "collections.json"
+
+	SavedRunTimeout   = 60 * time.Second // longest a run may take, whatever its timeout
+	SavedRunMaxFrames = 1000             // frames collected before a run is stopped
+)
+
+// Log messages as variables
+var (
+	MsgInvalidCollectionJSON = "Invalid collection JSON"
+	MsgCollectionsLoadFailed = "Failed to load collections"
+	MsgCollectionsSaveFailed = "Failed to save collections"
+	MsgFolderNotFound        = "Folder not found"
+	MsgFolderNotEmpty        = "Folder is not empty"
+	MsgFolderCycle           = "Folder cannot be moved into itself"
+	MsgSavedRequestNotFound  = "Saved request not found"
+	MsgNameRequired          = "Name is required"
+	MsgMethodRequired        = "Service and method are required"
+	MsgFolderDeleted         = "Folder deleted"
+	MsgSavedRequestDeleted   = "Saved request deleted"
+	MsgSavedFlowUnsupported  = "Saved requests cannot use flow control"
+	MsgSavedDeadline         = "Saved requests take a timeout, not a deadline"
+	MsgSavedRunTooManyFrames = "Run stopped: too many frames"
+)
+
+// Folder groups saved requests. Folders nest through ParentID.
+type Folder struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  string    `json:"parentId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SavedRequest is a call kept for re-use: the init message that starts it
+// and the request messages it sends, in the init's input encoding. The
+// workspace is not saved; a saved request runs against the caller's.
+type SavedRequest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	FolderID string `json:"folderId,omitempty"`
+	InitMessage
+	Messages  []json.RawMessage `json:"messages,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// collectionStore is the content of the collections file.
+type collectionStore struct {
+	Folders  []*Folder       `json:"folders"`
+	Requests []*SavedRequest `json:"requests"`
+}
+
+// CollectionError is a rejected collections operation, with the HTTP status
+// to report it with.
+type CollectionError struct {
+	Status  int
+	Message string
+}
+
+func (e *CollectionError) Error() string {
+	return e.Message
+}
+
+var (
+	collections   *collectionStore // loaded on first use
+	collectionsMu sync.Mutex
+)
+
+// List collections handler
+func HandleListCollections(c *gin.Context) {
+	collectionsMu.Lock()
+	defer collectionsMu.Unlock()
+
+	store, err := loadCollections()
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, store)
+}
+
+// Create folder handler
+func HandleCreateFolder(c *gin.Context) {
+	var folder Folder
+	if err := c.ShouldBindJSON(&folder); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidCollectionJSON, "details": err.Error()})
+		return
+	}
+
+	folder.ID = uuid.NewString()
+	folder.CreatedAt = time.Now()
+	folder.UpdatedAt = folder.CreatedAt
+
+	err := updateCollections(func(store *collectionStore) error {
+		if err := store.validateFolder(&folder); err != nil {
+			return err
+		}
+		dup := folder
+		store.Folders = append(store.Folders, &dup)
+		return nil
+	})
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, folder)
+}
+
+// Update folder handler: renames or moves a folder
+func HandleUpdateFolder(c *gin.Context) {
+	var update Folder
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidCollectionJSON, "details": err.Error()})
+		return
+	}
+
+	var folder Folder
+	err := updateCollections(func(store *collectionStore) error {
+		existing := store.folder(c.Param("id"))
+		if existing == nil {
+			return &CollectionError{Status: http.StatusNotFound, Message: MsgFolderNotFound}
+		}
+
+		update.ID = existing.ID
+		update.CreatedAt = existing.CreatedAt
+		update.UpdatedAt = time.Now()
+		if err := store.validateFolder(&update); err != nil {
+			return err
+		}
+
+		*existing = update
+		folder = update
+		return nil
+	})
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
+
+// Delete folder handler. Only empty folders can be deleted.
+func HandleDeleteFolder(c *gin.Context) {
+	id := c.Param("id")
+	err := updateCollections(func(store *collectionStore) error {
+		if store.folder(id) == nil {
+			return &CollectionError{Status: http.StatusNotFound, Message: MsgFolderNotFound}
+		}
+
+		for _, f := range store.Folders {
+			if f.ParentID == id {
+				return &CollectionError{Status: http.StatusConflict, Message: MsgFolderNotEmpty}
+			}
+		}
+		for _, r := range store.Requests {
+			if r.FolderID == id {
+				return &CollectionError{Status: http.StatusConflict, Message: MsgFolderNotEmpty}
+			}
+		}
+
+		for i, f := range store.Folders {
+			if f.ID == id {
+				store.Folders = append(store.Folders[:i], store.Folders[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": MsgFolderDeleted})
+}
+
+// Get saved request handler
+func HandleGetSavedRequest(c *gin.Context) {
+	req, err := findSavedRequest(c.Param("id"))
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// Create saved request handler
+func HandleCreateSavedRequest(c *gin.Context) {
+	var req SavedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidCollectionJSON, "details": err.Error()})
+		return
+	}
+
+	req.ID = uuid.NewString()
+	req.Workspace = ""
+	req.CreatedAt = time.Now()
+	req.UpdatedAt = req.CreatedAt
+
+	err := updateCollections(func(store *collectionStore) error {
+		if err := store.validateRequest(&req); err != nil {
+			return err
+		}
+		dup := req
+		store.Requests = append(store.Requests, &dup)
+		return nil
+	})
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, req)
+}
+
+// Update saved request handler: replaces everything but the ID
+func HandleUpdateSavedRequest(c *gin.Context) {
+	var update SavedRequest
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidCollectionJSON, "details": err.Error()})
+		return
+	}
+
+	var req SavedRequest
+	err := updateCollections(func(store *collectionStore) error {
+		existing := store.request(c.Param("id"))
+		if existing == nil {
+			return &CollectionError{Status: http.StatusNotFound, Message: MsgSavedRequestNotFound}
+		}
+
+		update.ID = existing.ID
+		update.Workspace = ""
+		update.CreatedAt = existing.CreatedAt
+		update.UpdatedAt = time.Now()
+		if err := store.validateRequest(&update); err != nil {
+			return err
+		}
+
+		*existing = update
+		req = update
+		return nil
+	})
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// Delete saved request handler
+func HandleDeleteSavedRequest(c *gin.Context) {
+	id := c.Param("id")
+	err := updateCollections(func(store *collectionStore) error {
+		for i, r := range store.Requests {
+			if r.ID == id {
+				store.Requests = append(store.Requests[:i], store.Requests[i+1:]...)
+				return nil
+			}
+		}
+		return &CollectionError{Status: http.StatusNotFound, Message: MsgSavedRequestNotFound}
+	})
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": MsgSavedRequestDeleted})
+}
+
+// Run saved request handler. The call runs like a WebSocket call that sends
+// the saved messages and then half-closes, in the caller's workspace; the
+// reply lists every frame it produced. Runs are bounded by SavedRunTimeout
+// and SavedRunMaxFrames, since the whole reply is held in memory.
+func HandleRunSavedRequest(c *gin.Context) {
+	req, err := findSavedRequest(c.Param("id"))
+	if err != nil {
+		respondCollectionError(c, err)
+		return
+	}
+
+	// Nobody is there to grant flow control credits. The deadline is ours;
+	// callContext keeps the saved timeout if it is shorter.
+	init := req.InitMessage
+	init.Flow = nil
+	deadline := time.Now().Add(SavedRunTimeout)
+	init.Deadline = &deadline
+
+	conn := newReplayConn(c, req.Messages, SavedRunMaxFrames)
+	runCall(conn, &init, workspaceIDFromRequest(c))
+	conn.close()
+
+	c.JSON(http.StatusOK, gin.H{"id": req.ID, "frames": conn.collected()})
+}
+
+func respondCollectionError(c *gin.Context, err error) {
+	var collErr *CollectionError
+	if errors.As(err, &collErr) {
+		c.JSON(collErr.Status, gin.H{"error": collErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// findSavedRequest returns a copy of the saved request with the given ID.
+func findSavedRequest(id string) (*SavedRequest, error) {
+	collectionsMu.Lock()
+	defer collectionsMu.Unlock()
+
+	store, err := loadCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	req := store.request(id)
+	if req == nil {
+		return nil, &CollectionError{Status: http.StatusNotFound, Message: MsgSavedRequestNotFound}
+	}
+
+	dup := *req
+	return &dup, nil
+}
+
+// updateCollections runs fn on the store and saves the result. Nothing is
+// saved if fn fails; if saving fails, the store is reloaded from disk on
+// next use so that memory never runs ahead of the file.
+func updateCollections(fn func(store *collectionStore) error) error {
+	collectionsMu.Lock()
+	defer collectionsMu.Unlock()
+
+	store, err := loadCollections()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(store); err != nil {
+		return err
+	}
+
+	if err := saveCollections(store); err != nil {
+		collections = nil
+		return fmt.Errorf("%s: %v", MsgCollectionsSaveFailed, err)
+	}
+	return nil
+}
+
+func dataDir() string {
+	if dir := os.Getenv(DataDirEnv); dir != "" {
+		return dir
+	}
+	return DefaultDataDir
+}
+
+// loadCollections returns the store, reading the collections file on first
+// use. A missing file is an empty store. The caller holds collectionsMu.
+func loadCollections() (*collectionStore, error) {
+	if collections != nil {
+		return collections, nil
+	}
+
+	store := &collectionStore{Folders: []*Folder{}, Requests: []*SavedRequest{}}
+	data, err := os.ReadFile(filepath.Join(dataDir(), CollectionsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %v", MsgCollectionsLoadFailed, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, store); err != nil {
+			return nil, fmt.Errorf("%s: %v", MsgCollectionsLoadFailed, err)
+		}
+	}
+
+	collections = store
+	return store, nil
+}
+
+// saveCollections writes the store to a temporary file and renames it over
+// the collections file, so a crash never leaves a half-written file.
+func saveCollections(store *collectionStore) error {
+	dir := dataDir()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, CollectionsFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, CollectionsFile))
+}
+
+func (s *collectionStore) folder(id string) *Folder {
+	for _, f := range s.Folders {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *collectionStore) request(id string) *SavedRequest {
+	for _, r := range s.Requests {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// validateFolder checks that folder is named and that its parent exists
+// and is not the folder itself or one of its descendants.
+func (s *collectionStore) validateFolder(folder *Folder) error {
+	if folder.Name == "" {
+		return &CollectionError{Status: http.StatusBadRequest, Message: MsgNameRequired}
+	}
+
+	for parentID := folder.ParentID; parentID != ""; {
+		if parentID == folder.ID {
+			return &CollectionError{Status: http.StatusBadRequest, Message: MsgFolderCycle}
+		}
+
+		parent := s.folder(parentID)
+		if parent == nil {
+			return &CollectionError{Status: http.StatusBadRequest, Message: MsgFolderNotFound}
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+func (s *collectionStore) validateRequest(req *SavedRequest) error {
+	if req.Name == "" {
+		return &CollectionError{Status: http.StatusBadRequest, Message: MsgNameRequired}
+	}
+
+	if req.Service == "" || req.Method == "" {
+		return &CollectionError{Status: http.StatusBadRequest, Message: MsgMethodRequired}
+	}
+
+	if req.FolderID != "" && s.folder(req.FolderID) == nil {
+		return &CollectionError{Status: http.StatusBadRequest, Message: MsgFolderNotFound}
+	}
+
+	if err := validateEncodings(&req.InitMessage); err != nil {
+		return &CollectionError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	if req.Flow != nil {
+		return &CollectionError{Status: http.StatusBadRequest, Message: MsgSavedFlowUnsupported}
+	}
+
+	if req.Deadline != nil {
+		return &CollectionError{Status: http.StatusBadRequest, Message: MsgSavedDeadline}
+	}
+	return nil
+}
+
+// replayConn is the streamConn of a saved request run. Reads return the
+// saved messages and then a half-close; after that they block until the
+// run is over or the client goes away. Written frames are collected, up to
+// maxFrames; the write after that fails, which stops the call.
+type replayConn struct {
+	c         *gin.Context
+	messages  [][]byte
+	maxFrames int
+	done      chan struct{}
+	doneOnce  sync.Once
+
+	mu     sync.Mutex
+	frames []*Frame
+	full   bool
+}
+
+func newReplayConn(c *gin.Context, messages []json.RawMessage, maxFrames int) *replayConn {
+	conn := &replayConn{c: c, maxFrames: maxFrames, done: make(chan struct{})}
+	for _, msg := range messages {
+		conn.messages = append(conn.messages, msg)
+	}
+	conn.messages = append(conn.messages, controlMessage(&ControlFrame{Control: ControlHalfClose}))
+	return conn
+}
+
+func (r *replayConn) close() {
+	r.doneOnce.Do(func() { close(r.done) })
+}
+
+func (r *replayConn) collected() []*Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*Frame{}, r.frames...)
+}
+
+func (r *replayConn) ReadMessage() (int, []byte, error) {
+	r.mu.Lock()
+	if len(r.messages) > 0 {
+		msg := r.messages[0]
+		r.messages = r.messages[1:]
+		r.mu.Unlock()
+		return websocket.TextMessage, msg, nil
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+	case <-r.c.Request.Context().Done():
+	}
+	return 0, nil, io.EOF
+}
+
+// WriteMessage collects an already encoded frame.
+func (r *replayConn) WriteMessage(_ int, data []byte) error {
+	var frame Frame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return err
+	}
+	return r.WriteJSON(&frame)
+}
+
+func (r *replayConn) WriteJSON(v interface{}) error {
+	frame, ok := v.(*Frame)
+	if !ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return r.WriteMessage(websocket.TextMessage, data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.full {
+		return errors.New(MsgSavedRunTooManyFrames)
+	}
+
+	if len(r.frames) >= r.maxFrames {
+		r.full = true
+		r.frames = append(r.frames, &Frame{Type: FrameError, Error: MsgSavedRunTooManyFrames})
+		return errors.New(MsgSavedRunTooManyFrames)
+	}
+
+	dup := *frame
+	r.frames = append(r.frames, &dup)
+	return nil
+}
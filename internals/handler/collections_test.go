@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateSavedRequest(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	store := &collectionStore{}
+
+	tests := []struct {
+		name string
+		init InitMessage
+		err  string
+	}{
+		{"plain", InitMessage{Timeout: "5s"}, ""},
+		{"flow", InitMessage{Flow: &FlowConfig{Credits: 1}}, MsgSavedFlowUnsupported},
+		{"deadline", InitMessage{Deadline: &deadline}, MsgSavedDeadline},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &SavedRequest{Name: "r", InitMessage: tt.init}
+			req.Service, req.Method = "svc.S", "M"
+
+			err := store.validateRequest(req)
+			if got := errorString(err); got != tt.err {
+				t.Fatalf("error %q, want %q", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestReplayConnFrameLimit(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	conn := newReplayConn(c, nil, 2)
+
+	for i := 0; i < 2; i++ {
+		if err := conn.WriteJSON(&Frame{Type: FrameMessage}); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := conn.WriteJSON(&Frame{Type: FrameMessage}); err == nil {
+			t.Fatal("write past the limit succeeded")
+		}
+	}
+
+	frames := conn.collected()
+	if len(frames) != 3 || frames[2].Type != FrameError || frames[2].Error != MsgSavedRunTooManyFrames {
+		t.Fatalf("frames: %+v", frames)
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
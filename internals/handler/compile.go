@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/reporter"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// CompileDiagnostic is a single positioned error or warning produced while
+// compiling uploaded proto sources.
+type CompileDiagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// CompileError carries every diagnostic reported by a failed compilation.
+type CompileError struct {
+	Diagnostics []CompileDiagnostic
+}
+
+func (e *CompileError) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		if d.Severity == SeverityError {
+			msgs = append(msgs, d.String())
+		}
+	}
+	return fmt.Sprintf("%s: %s", MsgProtoCompileFailed, strings.Join(msgs, "; "))
+}
+
+func (d CompileDiagnostic) String() string {
+	if d.File == "" {
+		return d.Message
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// compileProtoFiles compiles the named files, resolved relative to roots
+// (and the configured importPaths), with the well-known types bundled. The
+// result includes all transitive imports, dependencies first, like
+// protoc --include_imports. Warnings, such as unused imports, are returned
+// with the result.
+func compileProtoFiles(ctx context.Context, roots, files []string) (*descriptorpb.FileDescriptorSet, []CompileDiagnostic, error) {
+	diagnostics := []CompileDiagnostic{}
+	collect := func(severity string) func(reporter.ErrorWithPos) {
+		return func(err reporter.ErrorWithPos) {
+			pos := err.GetPosition()
+			diagnostics = append(diagnostics, CompileDiagnostic{
+				File:     pos.Filename,
+				Line:     pos.Line,
+				Column:   pos.Col,
+				Message:  err.Unwrap().Error(),
+				Severity: severity,
+			})
+		}
+	}
+	reportError := collect(SeverityError)
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: append(append([]string{}, roots...), importPaths...),
+		}),
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			reportError(err)
+			return nil // keep going so every error is reported
+		}, collect(SeverityWarning)),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+
+	compiled, err := compiler.Compile(ctx, files...)
+	if err != nil {
+		if !errors.Is(err, reporter.ErrInvalidSource) {
+			diagnostics = append(diagnostics, CompileDiagnostic{Message: err.Error(), Severity: SeverityError})
+		}
+		return nil, nil, &CompileError{Diagnostics: diagnostics}
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]struct{})
+	for _, file := range compiled {
+		appendFileWithImports(fds, file, seen)
+	}
+	return fds, diagnostics, nil
+}
+
+func appendFileWithImports(fds *descriptorpb.FileDescriptorSet, file protoreflect.FileDescriptor, seen map[string]struct{}) {
+	if _, ok := seen[file.Path()]; ok {
+		return
+	}
+	seen[file.Path()] = struct{}{}
+
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		appendFileWithImports(fds, imports.Get(i).FileDescriptor, seen)
+	}
+	fds.File = append(fds.File, protodesc.ToFileDescriptorProto(file))
+}
+
+func writeDescriptorSet(fds *descriptorpb.FileDescriptorSet, outPath string) error {
+	data, err := proto.Marshal(fds)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, data, 0644)
+}
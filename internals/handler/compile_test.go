@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const unusedImportProto = `syntax = "proto3";
+package warn;
+import "google/protobuf/any.proto";
+
+message M {}
+`
+
+// A successful upload still reports warnings, e.g. unused imports.
+func TestProtoUploadReturnsWarnings(t *testing.T) {
+	ws := newWorkspace(t)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("proto", "warn.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(unusedImportProto))
+	w.Close()
+
+	router := gin.New()
+	router.POST("/api/upload/proto", HandleProtoUpload)
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/proto", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set(WorkspaceHeader, ws.ID)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", rec.Code, rec.Body)
+	}
+
+	var resp struct {
+		Diagnostics []CompileDiagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Diagnostics) != 1 {
+		t.Fatalf("diagnostics: %+v", resp.Diagnostics)
+	}
+	if d := resp.Diagnostics[0]; d.Severity != SeverityWarning || d.File != "warn.proto" || d.Line != 3 {
+		t.Fatalf("diagnostic: %+v", d)
+	}
+}
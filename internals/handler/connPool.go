@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+)
+
+// Connection pool configuration
+const (
+	ConnIdleTTL      = 5 * time.Minute
+	ConnJanitorEvery = time.Minute
+)
+
+// Log messages as variables
+var (
+	MsgConnNotFound    = "Connection not found"
+	MsgConnClosed      = "Connection closed"
+	MsgConnReconnected = "Connection replaced"
+	MsgConnEvicted     = "Evicted idle connection to %s"
+)
+
+// pooledConn is a ClientConn shared by every call to the same target with
+// the same credential settings.
+type pooledConn struct {
+	id        string
+	target    string
+	tlsCfg    *TLSConfig
+	tls       bool
+	lbPolicy  string
+	cc        *grpc.ClientConn
+	refs      int
+	retired   bool // replaced in the pool; closed once refs drops to zero
+	createdAt time.Time
+	lastUsed  time.Time
+}
+
+// ConnectionInfo is the API view of a pooled connection.
+type ConnectionInfo struct {
+	ID        string    `json:"id"`
+	Target    string    `json:"target"`
+	TLS       bool      `json:"tls"`
+	LBPolicy  string    `json:"loadBalancing,omitempty"`
+	State     string    `json:"state"`
+	InUse     int       `json:"inUse"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastUsed  time.Time `json:"lastUsed"`
+}
+
+var (
+	connPool        = make(map[string]*pooledConn)
+	connPoolMu      sync.Mutex
+	connPoolJanitor sync.Once
+)
+
+// List connections handler
+func HandleListConnections(c *gin.Context) {
+	connPoolMu.Lock()
+	infos := make([]ConnectionInfo, 0, len(connPool))
+	for _, pc := range connPool {
+		infos = append(infos, pc.info())
+	}
+	connPoolMu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.Before(infos[j].CreatedAt) })
+	c.JSON(http.StatusOK, infos)
+}
+
+// Reconnect handler. Dials a fresh connection with the same settings and
+// puts it in the pool under the same ID, so new calls use it at once. Calls
+// still running on the old connection finish there before it is closed.
+func HandleReconnectConnection(c *gin.Context) {
+	connPoolMu.Lock()
+	defer connPoolMu.Unlock()
+
+	old, ok := connPool[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgConnNotFound})
+		return
+	}
+
+	pc, err := newPooledConn(old.id, old.target, old.tlsCfg, old.lbPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": MsgDialTargetFailed, "details": err.Error()})
+		return
+	}
+	connPool[pc.id] = pc
+	old.retire()
+
+	c.JSON(http.StatusOK, gin.H{"message": MsgConnReconnected, "connection": pc.info()})
+}
+
+// Close connection handler. Calls still using the connection fail.
+func HandleCloseConnection(c *gin.Context) {
+	connPoolMu.Lock()
+	pc, ok := connPool[c.Param("id")]
+	delete(connPool, c.Param("id"))
+	connPoolMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgConnNotFound})
+		return
+	}
+
+	pc.cc.Close()
+	c.JSON(http.StatusOK, gin.H{"message": MsgConnClosed})
+}
+
+// acquireConn returns the pooled connection for target, tlsCfg and lbPolicy,
+// dialing one if needed. Every acquire must be paired with a release.
+func acquireConn(target string, tlsCfg *TLSConfig, lbPolicy string) (*pooledConn, error) {
+	id := connKey(target, tlsCfg, lbPolicy)
+
+	connPoolMu.Lock()
+	defer connPoolMu.Unlock()
+
+	if pc, ok := connPool[id]; ok {
+		pc.refs++
+		pc.lastUsed = time.Now()
+		return pc, nil
+	}
+
+	pc, err := newPooledConn(id, target, tlsCfg, lbPolicy)
+	if err != nil {
+		return nil, err
+	}
+	pc.refs = 1
+	connPool[id] = pc
+
+	connPoolJanitor.Do(func() { go evictIdleConns() })
+	return pc, nil
+}
+
+func newPooledConn(id, target string, tlsCfg *TLSConfig, lbPolicy string) (*pooledConn, error) {
+	cc, err := dialTarget(target, tlsCfg, lbPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &pooledConn{
+		id:        id,
+		target:    target,
+		tlsCfg:    tlsCfg,
+		tls:       usesTLS(target, tlsCfg),
+		lbPolicy:  lbPolicy,
+		cc:        cc,
+		createdAt: now,
+		lastUsed:  now,
+	}, nil
+}
+
+func (pc *pooledConn) release() {
+	connPoolMu.Lock()
+	defer connPoolMu.Unlock()
+
+	pc.refs--
+	pc.lastUsed = time.Now()
+	if pc.retired && pc.refs <= 0 {
+		pc.cc.Close()
+	}
+}
+
+// retire marks a connection that has left the pool, closing it now if no
+// call is using it. Must be called with connPoolMu held.
+func (pc *pooledConn) retire() {
+	pc.retired = true
+	if pc.refs <= 0 {
+		pc.cc.Close()
+	}
+}
+
+// info must be called with connPoolMu held.
+func (pc *pooledConn) info() ConnectionInfo {
+	return ConnectionInfo{
+		ID:        pc.id,
+		Target:    pc.target,
+		TLS:       pc.tls,
+		LBPolicy:  pc.lbPolicy,
+		State:     pc.cc.GetState().String(),
+		InUse:     pc.refs,
+		CreatedAt: pc.createdAt,
+		LastUsed:  pc.lastUsed,
+	}
+}
+
+func evictIdleConns() {
+	for range time.Tick(ConnJanitorEvery) {
+		connPoolMu.Lock()
+		for id, pc := range connPool {
+			if pc.refs <= 0 && time.Since(pc.lastUsed) > ConnIdleTTL {
+				delete(connPool, id)
+				pc.cc.Close()
+				fmt.Printf(MsgConnEvicted+"\n", pc.target)
+			}
+		}
+		connPoolMu.Unlock()
+	}
+}
+
+// connKey identifies a connection by target, credential settings and
+// load-balancing policy. The settings are hashed so that keys and IDs never
+// expose key material.
+func connKey(target string, tlsCfg *TLSConfig, lbPolicy string) string {
+	settings, _ := json.Marshal(tlsCfg)
+
+	sum := sha256.Sum256(append([]byte(target+"\x00"+lbPolicy+"\x00"), settings...))
+	return hex.EncodeToString(sum[:8])
+}
+
+func usesTLS(target string, tlsCfg *TLSConfig) bool {
+	if tlsCfg != nil {
+		return tlsCfg.enabled()
+	}
+	_, useTLS := parseTarget(target)
+	return useTLS
+}
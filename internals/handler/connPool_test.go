@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestReconnectConnection(t *testing.T) {
+	target := startHealthServer(t)
+
+	inUse, err := acquireConn(target, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		connPoolMu.Lock()
+		if pc := connPool[inUse.id]; pc != nil {
+			delete(connPool, inUse.id)
+			pc.cc.Close()
+		}
+		connPoolMu.Unlock()
+	})
+
+	router := gin.New()
+	router.POST("/api/connections/:id/reconnect", HandleReconnectConnection)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/connections/"+inUse.id+"/reconnect", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reconnect: %d %s", rec.Code, rec.Body)
+	}
+
+	// New calls get the replacement under the same ID.
+	fresh, err := acquireConn(target, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh.release()
+	if fresh == inUse || fresh.id != inUse.id {
+		t.Fatalf("acquired %p (%s) after reconnecting %p (%s)", fresh, fresh.id, inUse, inUse.id)
+	}
+
+	// The old connection stays up for the call using it, then closes.
+	if state := inUse.cc.GetState(); state == connectivity.Shutdown {
+		t.Fatal("old connection closed while in use")
+	}
+	inUse.release()
+	if state := inUse.cc.GetState(); state != connectivity.Shutdown {
+		t.Fatalf("old connection %v after its last call", state)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/connections/nope/reconnect", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown id: %d", rec.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Log messages as variables
+var (
+	MsgDescriptorSetLoaded    = "Descriptor set uploaded and loaded successfully"
+	MsgInvalidDescriptorSet   = "Invalid descriptor set: %v"
+	MsgEmptyDescriptorSet     = "Descriptor set contains no files"
+	MsgDescriptorSetMustStand = "A descriptor set must be uploaded on its own"
+)
+
+// descriptorSetExtensions are the file suffixes produced by
+// protoc --descriptor_set_out and buf build -o.
+var descriptorSetExtensions = []string{".protoset", ".binpb", ".pb", ".desc", ".json"}
+
+func isDescriptorSetUpload(file *multipart.FileHeader) bool {
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	for _, candidate := range descriptorSetExtensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func readDescriptorSetUpload(file *multipart.FileHeader) (*descriptorpb.FileDescriptorSet, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, MaxExtractedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxExtractedBytes {
+		return nil, errors.New(MsgArchiveTooLarge)
+	}
+
+	return parseDescriptorSet(data)
+}
+
+// parseDescriptorSet decodes a binary or JSON-encoded FileDescriptorSet and
+// checks that it links, i.e. that every file's imports are included.
+func parseDescriptorSet(data []byte) (*descriptorpb.FileDescriptorSet, error) {
+	var fds descriptorpb.FileDescriptorSet
+
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = protojson.Unmarshal(trimmed, &fds)
+	} else {
+		err = proto.Unmarshal(data, &fds)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(MsgInvalidDescriptorSet, err)
+	}
+
+	if len(fds.GetFile()) == 0 {
+		return nil, errors.New(MsgEmptyDescriptorSet)
+	}
+
+	if _, err := desc.CreateFileDescriptors(fds.GetFile()); err != nil {
+		return nil, fmt.Errorf(MsgInvalidDescriptorSet, err)
+	}
+
+	return &fds, nil
+}
+
+// storeDescriptorSetUpload validates an uploaded descriptor set, persists it
+// as the workspace's protoset and loads it, skipping compilation entirely.
+func storeDescriptorSetUpload(ws *Workspace, file *multipart.FileHeader) ([]string, error) {
+	fds, err := readDescriptorSetUpload(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeDescriptorSet(fds, ws.descriptorSetPath()); err != nil {
+		return nil, err
+	}
+
+	if err := ws.loadDescriptorSet(); err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(fds.GetFile()))
+	for _, fd := range fds.GetFile() {
+		files = append(files, fd.GetName())
+	}
+	return files, nil
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+type PayloadEncoding string
+
+// Payload encodings. Text and binary payloads travel as JSON strings in
+// frames and request bodies; on a WebSocket the bare text is accepted too.
+const (
+	EncodingJSON   PayloadEncoding = "json"   // proto3 JSON, the default
+	EncodingText   PayloadEncoding = "text"   // protobuf text format
+	EncodingBinary PayloadEncoding = "binary" // base64 of the wire bytes
+)
+
+// Log messages as variables
+var (
+	MsgInvalidEncoding = "Invalid payload encoding"
+	MsgInvalidBase64   = "Invalid base64 payload"
+)
+
+func (e PayloadEncoding) validate() error {
+	switch e {
+	case "", EncodingJSON, EncodingText, EncodingBinary:
+		return nil
+	default:
+		return fmt.Errorf("%s: %q", MsgInvalidEncoding, e)
+	}
+}
+
+// validateEncodings checks the input and output encodings of init.
+func validateEncodings(init *InitMessage) error {
+	if err := init.InputEncoding.validate(); err != nil {
+		return err
+	}
+	return init.OutputEncoding.validate()
+}
+
+// emptyPayload is the encoding's form of a message with no fields set.
+func (e PayloadEncoding) emptyPayload() []byte {
+	switch e {
+	case EncodingText, EncodingBinary:
+		return []byte(`""`)
+	default:
+		return []byte("{}")
+	}
+}
+
+// decodeMessage fills msg from data in encoding e. resolver finds the types
+// named by Any values in JSON; the text format can only expand Any values of
+// types msg's file imports.
+func (e PayloadEncoding) decodeMessage(msg *dynamic.Message, data []byte, resolver *typeResolver) error {
+	switch e {
+	case EncodingText:
+		return msg.UnmarshalText(payloadString(data))
+	case EncodingBinary:
+		wire, err := decodeBase64(string(payloadString(data)))
+		if err != nil {
+			return fmt.Errorf("%s: %v", MsgInvalidBase64, err)
+		}
+		return msg.Unmarshal(wire)
+	default:
+		return msg.UnmarshalJSONPB(&jsonpb.Unmarshaler{AnyResolver: resolver}, data)
+	}
+}
+
+// encodeMessage renders msg in encoding e as a JSON value, ready to be
+// embedded in a frame. opts and resolver apply to the JSON encoding only.
+func (e PayloadEncoding) encodeMessage(msg *dynamic.Message, opts *JSONOptions, resolver *typeResolver) (json.RawMessage, error) {
+	switch e {
+	case EncodingText:
+		text, err := msg.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(string(text))
+	case EncodingBinary:
+		wire, err := msg.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(base64.StdEncoding.EncodeToString(wire))
+	default:
+		return opts.marshalMessage(msg, resolver)
+	}
+}
+
+// payloadString unwraps data if it is a JSON string and returns it as is
+// otherwise, so that pasted text needs no quoting.
+func payloadString(data []byte) []byte {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		return []byte(s)
+	}
+	return data
+}
+
+// decodeBase64 accepts standard or URL-safe base64, padded or not, and
+// ignores surrounding whitespace and line breaks.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Example generation limits
+const (
+	ExampleMaxRecursion = 1 // times a message may nest inside itself
+	ExampleMaxDepth     = 8
+)
+
+// Log messages as variables
+var (
+	MsgExampleFailed = "Failed to build example"
+)
+
+// Example handler. Returns a populated JSON input for a method.
+func HandleExample(c *gin.Context) {
+	reg := registryFromRequest(c)
+	if reg == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoDescriptorLoaded})
+		return
+	}
+
+	md := reg.findMethod(c.Param("service"), c.Param("method"))
+	if md == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgMethodNotFound})
+		return
+	}
+
+	data, err := exampleMessage(md.GetInputType(), nil).MarshalJSONPB(&jsonpb.Marshaler{AnyResolver: reg.resolver()})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": MsgExampleFailed, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"service": md.GetService().GetFullyQualifiedName(),
+		"method":  md.GetName(),
+		"type":    md.GetInputType().GetFullyQualifiedName(),
+		"example": json.RawMessage(data),
+	})
+}
+
+// exampleMessage builds an instance of md with every field set: scalars get
+// a typical value, enums their first non-zero value, repeated and map fields
+// one element, oneofs their first member. path counts the messages being
+// built above this one; a field whose type would nest past the recursion
+// limit is left unset.
+func exampleMessage(md *desc.MessageDescriptor, path map[string]int) *dynamic.Message {
+	msg := dynamic.NewMessage(md)
+	if exampleWellKnown(msg) {
+		return msg
+	}
+
+	name := md.GetFullyQualifiedName()
+	if path == nil {
+		path = make(map[string]int)
+	}
+	path[name]++
+	defer func() { path[name]-- }()
+
+	depth := 0
+	for _, n := range path {
+		depth += n
+	}
+
+	for _, fd := range md.GetFields() {
+		if od := fd.GetOneOf(); od != nil && !od.IsSynthetic() && od.GetChoices()[0] != fd {
+			continue
+		}
+
+		if mt := exampleMessageType(fd); mt != nil {
+			if depth >= ExampleMaxDepth || path[mt.GetFullyQualifiedName()] > ExampleMaxRecursion {
+				continue
+			}
+		}
+
+		switch {
+		case fd.IsMap():
+			key, value := fd.GetMapKeyType(), fd.GetMapValueType()
+			msg.PutMapField(fd, exampleValue(key, path), exampleValue(value, path))
+		case fd.IsRepeated():
+			msg.AddRepeatedField(fd, exampleValue(fd, path))
+		default:
+			msg.SetField(fd, exampleValue(fd, path))
+		}
+	}
+
+	return msg
+}
+
+// exampleMessageType is the message type a field (or map value) holds.
+func exampleMessageType(fd *desc.FieldDescriptor) *desc.MessageDescriptor {
+	if fd.IsMap() {
+		return fd.GetMapValueType().GetMessageType()
+	}
+	return fd.GetMessageType()
+}
+
+func exampleValue(fd *desc.FieldDescriptor, path map[string]int) interface{} {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return exampleMessage(fd.GetMessageType(), path)
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		values := fd.GetEnumType().GetValues()
+		for _, vd := range values {
+			if vd.GetNumber() != 0 {
+				return vd.GetNumber()
+			}
+		}
+		return values[0].GetNumber()
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32(1)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return int64(1)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(1)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return uint64(1)
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return float32(1.5)
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return 1.5
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return true
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return []byte(fd.GetName())
+	default:
+		return fd.GetName()
+	}
+}
+
+// exampleWellKnown fills well-known types whose JSON form is special:
+// Timestamp (now), Duration (1s), Any (a StringValue) and Value (a string,
+// rather than the null its first oneof member would give). It reports
+// whether msg was one of them.
+func exampleWellKnown(msg *dynamic.Message) bool {
+	switch msg.GetMessageDescriptor().GetFullyQualifiedName() {
+	case "google.protobuf.Timestamp":
+		msg.SetFieldByName("seconds", time.Now().Unix())
+	case "google.protobuf.Duration":
+		msg.SetFieldByName("seconds", int64(1))
+	case "google.protobuf.Value":
+		msg.SetFieldByName("string_value", "example")
+	case "google.protobuf.Any":
+		value, _ := proto.Marshal(wrapperspb.String("example"))
+		msg.SetFieldByName("type_url", "type.googleapis.com/google.protobuf.StringValue")
+		msg.SetFieldByName("value", value)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type FlowPolicy string
+
+// Policies for a full response buffer: pause stops receiving from the
+// backend until the client grants credits, which pushes back on the server
+// through gRPC flow control; drop discards the oldest buffered message.
+const (
+	FlowPause FlowPolicy = "pause"
+	FlowDrop  FlowPolicy = "drop"
+)
+
+// Flow control configuration
+const (
+	DefaultFlowBuffer = 256
+	MaxFlowBuffer     = 10000
+)
+
+// Log messages as variables
+var (
+	MsgInvalidFlowPolicy = "Invalid flow policy"
+	MsgInvalidFlowBuffer = "Invalid flow buffer size"
+	MsgInvalidFlowCredit = "Invalid flow credits"
+	MsgFlowNotEnabled    = "Flow control is not enabled for this call"
+	MsgInvalidGrant      = "Grant needs a positive credits count"
+)
+
+// FlowConfig enables credit-based flow control for a call's responses. The
+// server sends message frames only while it holds credits; the client adds
+// credits with {"@control":"grant","credits":N}. Other frames need no credit.
+type FlowConfig struct {
+	Credits int        `json:"credits"`          // messages the client accepts up front
+	Buffer  int        `json:"buffer,omitempty"` // messages held while out of credit
+	Policy  FlowPolicy `json:"policy,omitempty"` // pause (default) or drop
+}
+
+func (f *FlowConfig) validate() error {
+	switch f.Policy {
+	case "", FlowPause, FlowDrop:
+	default:
+		return fmt.Errorf("%s: %q", MsgInvalidFlowPolicy, f.Policy)
+	}
+
+	if f.Buffer < 0 || f.Buffer > MaxFlowBuffer {
+		return fmt.Errorf("%s: %d", MsgInvalidFlowBuffer, f.Buffer)
+	}
+
+	if f.Credits < 0 {
+		return fmt.Errorf("%s: %d", MsgInvalidFlowCredit, f.Credits)
+	}
+	return nil
+}
+
+// outbox queues a call's frames and writes them in order as credits allow.
+// Once the call's context is done, buffered messages that were never
+// granted are dropped so that the trailer and status still get through.
+type outbox struct {
+	ctx    context.Context
+	write  func(*Frame) error
+	policy FlowPolicy
+	limit  int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	frames   []*Frame
+	messages int // message frames in frames
+	credits  int
+	dropped  int
+	closed   bool
+	err      error
+	done     chan struct{}
+}
+
+func newOutbox(ctx context.Context, cfg *FlowConfig, write func(*Frame) error) *outbox {
+	ob := &outbox{
+		ctx:     ctx,
+		write:   write,
+		policy:  cfg.Policy,
+		limit:   cfg.Buffer,
+		credits: cfg.Credits,
+		done:    make(chan struct{}),
+	}
+	if ob.policy == "" {
+		ob.policy = FlowPause
+	}
+	if ob.limit == 0 {
+		ob.limit = DefaultFlowBuffer
+	}
+	ob.cond = sync.NewCond(&ob.mu)
+
+	context.AfterFunc(ctx, ob.wake)
+	go ob.run()
+	return ob
+}
+
+func (ob *outbox) wake() {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.cond.Broadcast()
+}
+
+// push queues frame. With the pause policy it blocks while the buffer is
+// full. It fails once a write has failed.
+func (ob *outbox) push(frame *Frame) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if frame.Type == FrameMessage {
+		for ob.policy == FlowPause && ob.messages >= ob.limit && ob.err == nil && ob.ctx.Err() == nil {
+			ob.cond.Wait()
+		}
+	}
+
+	if ob.err != nil {
+		return ob.err
+	}
+
+	if frame.Type == FrameMessage {
+		if ob.messages >= ob.limit {
+			ob.dropOldest()
+		}
+		ob.messages++
+	}
+
+	ob.frames = append(ob.frames, frame)
+	ob.cond.Broadcast()
+	return nil
+}
+
+func (ob *outbox) grant(credits int) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.credits += credits
+	ob.cond.Broadcast()
+}
+
+// flush writes whatever is still queued and waits for the writer to stop.
+func (ob *outbox) flush() {
+	ob.mu.Lock()
+	ob.closed = true
+	ob.cond.Broadcast()
+	ob.mu.Unlock()
+
+	<-ob.done
+}
+
+func (ob *outbox) run() {
+	defer close(ob.done)
+
+	for {
+		frame, ok := ob.next()
+		if !ok {
+			return
+		}
+
+		if err := ob.write(frame); err != nil {
+			ob.mu.Lock()
+			ob.err = err
+			ob.cond.Broadcast()
+			ob.mu.Unlock()
+			return
+		}
+	}
+}
+
+// next waits for a frame that can be written now. It reports false once
+// the outbox is flushed and empty.
+func (ob *outbox) next() (*Frame, bool) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for {
+		if ob.ctx.Err() != nil {
+			for ob.messages > 0 && ob.credits <= 0 {
+				ob.dropOldest()
+			}
+		}
+
+		if len(ob.frames) > 0 && (ob.frames[0].Type != FrameMessage || ob.credits > 0) {
+			break
+		}
+		if ob.closed && len(ob.frames) == 0 {
+			return nil, false
+		}
+		ob.cond.Wait()
+	}
+
+	frame := ob.frames[0]
+	ob.frames = ob.frames[1:]
+
+	switch frame.Type {
+	case FrameMessage:
+		ob.messages--
+		ob.credits--
+		ob.cond.Broadcast()
+	case FrameStatus:
+		frame.Dropped = ob.dropped
+	}
+
+	return frame, true
+}
+
+// dropOldest discards the first buffered message frame. Must be called with
+// ob.mu held.
+func (ob *outbox) dropOldest() {
+	for i, frame := range ob.frames {
+		if frame.Type == FrameMessage {
+			ob.frames = append(ob.frames[:i], ob.frames[i+1:]...)
+			ob.messages--
+			ob.dropped++
+			return
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"archive/zip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -12,11 +11,8 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -28,17 +24,16 @@ import (
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
 )
 
 // Constants and configuration
 const (
-	DefaultProtocVersion = "24.4"
-	CleanupDelay         = 10 * time.Minute
-	DefaultDialTimeout   = 30 * time.Second
-	DefaultPort443       = ":443"
-	DefaultPort80        = ":80"
+	CleanupDelay       = 10 * time.Minute
+	DefaultDialTimeout = 30 * time.Second
+	DefaultPort443     = ":443"
+	DefaultPort80      = ":80"
 )
 
 // Log messages as variables
@@ -48,8 +43,7 @@ var (
 	MsgNoFileUploaded        = "No file uploaded"
 	MsgCreateUploadDirFailed = "Could not create upload dir"
 	MsgSaveFileFailed        = "Could not save file"
-	MsgProtocInstallFailed   = "protoc not installed and failed to download: %s"
-	MsgProtoCompileFailed    = "Failed to compile .proto with protoc"
+	MsgProtoCompileFailed    = "Failed to compile .proto"
 	MsgReadDescriptorFailed  = "Could not read descriptor set"
 	MsgParseDescriptorFailed = "Failed to parse descriptor set"
 	MsgNoDescriptorLoaded    = "No descriptor loaded"
@@ -68,16 +62,16 @@ var (
 	MsgBidiStreamFailed      = "Bidi stream failed"
 	MsgRPCCallFailed         = "RPC call failed"
 	MsgUnexpectedResponse    = "Unexpected response type"
-	MsgUnsupportedOS         = "unsupported OS: %s"
+	MsgInvalidTimeout        = "Invalid timeout"
+	MsgUnknownControl        = "Unknown control frame"
+	MsgUnexpectedMessage     = "Unexpected message: the call takes no further input"
+	MsgInputQueueFull        = "Too many request messages waiting for the backend; message dropped"
 )
 
 // Global variables with better organization
 var (
-	descriptorSetPath = "./compiled.protoset"
-	tempProtoDir      = "./uploaded_protos"
-	importPaths       []string
-	descriptorSet     descriptorpb.FileDescriptorSet
-	descriptorSetMu   sync.RWMutex // Protect concurrent access
+	tempProtoDir = "./uploaded_protos"
+	importPaths  []string
 )
 
 // WebSocket upgrader configuration
@@ -87,14 +81,32 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// streamConn is the message transport a call runs over: a WebSocket, or a
+// WebRTC data channel adapted to the same read/write surface.
+type streamConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteJSON(v interface{}) error
+}
+
 // Data structures
 type InitMessage struct {
-	Target   string            `json:"target"`
-	Service  string            `json:"service"`
-	Method   string            `json:"method"`
-	Mode     string            `json:"mode"`
-	Metadata map[string]string `json:"metadata,omitempty"`
-	Auth     *AuthConfig       `json:"auth,omitempty"`
+	Workspace string            `json:"workspace,omitempty"`
+	Target    string            `json:"target"`
+	Service   string            `json:"service"`
+	Method    string            `json:"method"`
+	Mode      string            `json:"mode"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Auth      *AuthConfig       `json:"auth,omitempty"`
+	TLS       *TLSConfig        `json:"tls,omitempty"`
+	LBPolicy  string            `json:"loadBalancing,omitempty"` // pick_first or round_robin
+	Flow      *FlowConfig       `json:"flow,omitempty"`
+	JSON      *JSONOptions      `json:"json,omitempty"`
+	Timeout   string            `json:"timeout,omitempty"`  // Go duration, e.g. "5s"
+	Deadline  *time.Time        `json:"deadline,omitempty"` // RFC 3339
+
+	InputEncoding  PayloadEncoding `json:"inputEncoding,omitempty"`  // json, text or binary
+	OutputEncoding PayloadEncoding `json:"outputEncoding,omitempty"` // json, text or binary
 }
 
 type AuthConfig struct {
@@ -107,12 +119,10 @@ type AuthConfig struct {
 type StreamMode string
 
 const (
-	ModeUnary     StreamMode = "unary"
-	ModeServer    StreamMode = "server"
-	ModeClient    StreamMode = "client"
-	ModeBidi      StreamMode = "bidi"
-	EndSignal                = "__END__"
-	EndJSONSignal            = `{"end": true}`
+	ModeUnary  StreamMode = "unary"
+	ModeServer StreamMode = "server"
+	ModeClient StreamMode = "client"
+	ModeBidi   StreamMode = "bidi"
 )
 
 // Error definitions
@@ -130,49 +140,101 @@ var (
 
 // Proto upload handler
 func HandleProtoUpload(c *gin.Context) {
-	file, err := c.FormFile("proto")
-	if err != nil {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["proto"]) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoFileUploaded})
 		return
 	}
 
-	userDir, err := createUserDirectory()
+	ws, err := resolveOrCreateWorkspace(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": MsgCreateUploadDirFailed})
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgWorkspaceNotFound})
+		return
+	}
+
+	if uploads := form.File["proto"]; hasDescriptorSetUpload(uploads) {
+		handleDescriptorSetUpload(c, ws, uploads)
 		return
 	}
 
-	savedPath, err := saveUploadedFile(c, file, userDir)
+	userDir, err := createUserDirectory(ws)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": MsgSaveFileFailed})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": MsgCreateUploadDirFailed})
 		return
 	}
 
-	if err := compileProtoFile(savedPath, userDir); err != nil {
+	var written int64
+	for _, file := range form.File["proto"] {
+		if err := storeUpload(file, userDir, &written); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": MsgSaveFileFailed, "details": err.Error()})
+			return
+		}
+	}
+
+	files, warnings, err := compileProtoTree(c.Request.Context(), userDir, ws.descriptorSetPath())
+	if err != nil {
+		if errors.Is(err, ErrNoProtoFiles) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoProtoFiles})
+			return
+		}
+
+		var compileErr *CompileError
+		if errors.As(err, &compileErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": MsgProtoCompileFailed, "diagnostics": compileErr.Diagnostics})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := loadDescriptorSet(); err != nil {
+	if err := ws.loadDescriptorSet(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	scheduleCleanup(userDir)
-	c.JSON(http.StatusOK, gin.H{"message": MsgProtoUploaded})
+	c.JSON(http.StatusOK, gin.H{"message": MsgProtoUploaded, "workspaceId": ws.ID, "files": files, "diagnostics": warnings})
+}
+
+func hasDescriptorSetUpload(uploads []*multipart.FileHeader) bool {
+	for _, file := range uploads {
+		if isDescriptorSetUpload(file) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleDescriptorSetUpload(c *gin.Context, ws *Workspace, uploads []*multipart.FileHeader) {
+	if len(uploads) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgDescriptorSetMustStand})
+		return
+	}
+
+	files, err := storeDescriptorSetUpload(ws, uploads[0])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": MsgDescriptorSetLoaded, "workspaceId": ws.ID, "files": files})
 }
 
 // List services handler
 func HandleListServices(c *gin.Context) {
-	descriptorSetMu.RLock()
-	defer descriptorSetMu.RUnlock()
+	ws, err := resolveWorkspace(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoDescriptorLoaded})
+		return
+	}
 
-	if len(descriptorSet.File) == 0 {
+	reg := ws.currentRegistry()
+	if reg == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoDescriptorLoaded})
 		return
 	}
 
-	result := listServicesAndMethods()
+	result := listServicesAndMethods(reg)
 	c.JSON(http.StatusOK, result)
 }
 
@@ -184,93 +246,128 @@ func HandleGRPCWebSocketStream(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	init, err := readInitMessage(conn)
+	_, first, err := conn.ReadMessage()
 	if err != nil {
-		conn.WriteJSON(gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx := buildContext(init)
-	methodDesc, err := findMethodDescriptor(init)
+	// Versioned envelopes multiplex many calls; anything else is the init
+	// message of a single call.
+	if isMuxEnvelope(first) {
+		serveMux(conn, first, workspaceIDFromRequest(c))
+		return
+	}
+
+	init, err := parseInitMessage(first)
 	if err != nil {
-		conn.WriteJSON(gin.H{"error": err.Error()})
+		conn.WriteJSON(&Frame{Type: FrameError, Error: err.Error()})
 		return
 	}
+	runCall(conn, init, workspaceIDFromRequest(c))
+}
 
-	clientConn, err := dialTarget(init.Target)
+// serveCall runs the init-then-messages call protocol over conn.
+func serveCall(conn streamConn, defaultWorkspace string) {
+	init, err := readInitMessage(conn)
 	if err != nil {
-		conn.WriteJSON(gin.H{"error": MsgDialTargetFailed, "details": err.Error()})
+		conn.WriteJSON(&Frame{Type: FrameError, Error: err.Error()})
 		return
 	}
-	defer clientConn.Close()
+	runCall(conn, init, defaultWorkspace)
+}
 
-	stub := grpcdynamic.NewStub(clientConn)
-	mode := determineStreamMode(init.Mode, methodDesc)
+// runCall performs the call described by init, reading request messages
+// from and writing frames to conn. The workspace named in the init message
+// wins over defaultWorkspace, which is whatever the transport's handshake
+// request referenced.
+func runCall(conn streamConn, init *InitMessage, defaultWorkspace string) {
+	if init.Workspace == "" {
+		init.Workspace = defaultWorkspace
+	}
 
-	if err := handleStreamMode(ctx, stub, conn, methodDesc, mode); err != nil {
-		conn.WriteJSON(gin.H{"error": err.Error()})
+	ws, err := lookupWorkspace(init.Workspace)
+	if err != nil {
+		conn.WriteJSON(&Frame{Type: FrameError, Error: MsgWorkspaceNotFound})
+		return
 	}
-}
 
-// Helper functions
-func createUserDirectory() (string, error) {
-	userDir := filepath.Join(tempProtoDir, fmt.Sprintf("user-%d", time.Now().UnixNano()))
-	return userDir, os.MkdirAll(userDir, os.ModePerm)
-}
+	if init.Flow != nil {
+		if err := init.Flow.validate(); err != nil {
+			conn.WriteJSON(&Frame{Type: FrameError, Error: err.Error()})
+			return
+		}
+	}
 
-func saveUploadedFile(c *gin.Context, file *multipart.FileHeader, userDir string) (string, error) {
-	savedPath := filepath.Join(userDir, file.Filename)
-	return savedPath, c.SaveUploadedFile(file, savedPath)
-}
+	if err := validateEncodings(init); err != nil {
+		conn.WriteJSON(&Frame{Type: FrameError, Error: err.Error()})
+		return
+	}
 
-func compileProtoFile(savedPath, userDir string) error {
-	protocPath, err := installProtocIfMissing()
+	ctx, cancel, err := callContext(init)
 	if err != nil {
-		return fmt.Errorf(MsgProtocInstallFailed, err.Error())
+		conn.WriteJSON(&Frame{Type: FrameError, Error: err.Error()})
+		return
 	}
+	defer cancel()
 
-	args := buildProtocArgs(userDir, savedPath)
-	cmd := exec.Command(protocPath, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return errors.New(MsgProtoCompileFailed)
+	methodDesc, err := ws.findMethodDescriptor(init)
+	if err != nil {
+		conn.WriteJSON(&Frame{Type: FrameError, Error: err.Error()})
+		return
 	}
-	return nil
-}
 
-func buildProtocArgs(userDir, savedPath string) []string {
-	args := make([]string, 0, len(importPaths)+5)
+	pooled, err := acquireConn(init.Target, init.TLS, init.LBPolicy)
+	if err != nil {
+		conn.WriteJSON(&Frame{Type: FrameError, Error: MsgDialTargetFailed, Details: err.Error()})
+		return
+	}
+	defer pooled.release()
 
-	for _, path := range importPaths {
-		args = append(args, "--proto_path="+path)
+	call := &rpcCall{
+		ctx:      ctx,
+		cancel:   cancel,
+		stub:     newDynamicStub(pooled.cc),
+		conn:     conn,
+		method:   methodDesc,
+		registry: ws.currentRegistry(),
+		jsonOpts: init.JSON,
+		input:    init.InputEncoding,
+		output:   init.OutputEncoding,
 	}
+	mode := determineStreamMode(init.Mode, methodDesc)
 
-	args = append(args,
-		"--proto_path="+userDir,
-		"--descriptor_set_out="+descriptorSetPath,
-		"--include_imports",
-		savedPath,
-	)
+	if init.Flow != nil {
+		call.enableFlowControl(init.Flow)
+	}
 
-	return args
+	call.startReading()
+	if err := handleStreamMode(call, mode); err != nil {
+		call.sendError(err.Error(), "")
+	}
+	call.finish()
 }
 
-func loadDescriptorSet() error {
-	descriptorSetMu.Lock()
-	defer descriptorSetMu.Unlock()
+// Helper functions
+func createUserDirectory(ws *Workspace) (string, error) {
+	userDir := filepath.Join(ws.Dir, fmt.Sprintf("user-%d", time.Now().UnixNano()))
+	return userDir, os.MkdirAll(userDir, os.ModePerm)
+}
 
-	data, err := os.ReadFile(descriptorSetPath)
+// compileProtoTree compiles every .proto file stored under userDir so that
+// cross-file imports resolve, and writes the result to outPath. It returns
+// the compiled files and any warnings.
+func compileProtoTree(ctx context.Context, userDir, outPath string) ([]string, []CompileDiagnostic, error) {
+	roots, files, err := collectProtoTree(userDir)
 	if err != nil {
-		return errors.New(MsgReadDescriptorFailed)
+		return nil, nil, err
 	}
 
-	if err := proto.Unmarshal(data, &descriptorSet); err != nil {
-		return errors.New(MsgParseDescriptorFailed)
+	fds, warnings, err := compileProtoFiles(ctx, roots, files)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil
+	return files, warnings, writeDescriptorSet(fds, outPath)
 }
 
 func scheduleCleanup(userDir string) {
@@ -283,15 +380,15 @@ func scheduleCleanup(userDir string) {
 	}(userDir)
 }
 
-func listServicesAndMethods() map[string][]string {
+func listServicesAndMethods(reg *descriptorRegistry) map[string][]string {
 	services := make(map[string][]string)
 
-	for _, file := range descriptorSet.File {
-		for _, service := range file.GetService() {
+	for _, file := range reg.files {
+		for _, service := range file.GetServices() {
 			serviceName := service.GetName()
-			methods := make([]string, 0, len(service.GetMethod()))
+			methods := make([]string, 0, len(service.GetMethods()))
 
-			for _, method := range service.GetMethod() {
+			for _, method := range service.GetMethods() {
 				methods = append(methods, method.GetName())
 			}
 
@@ -302,12 +399,16 @@ func listServicesAndMethods() map[string][]string {
 	return services
 }
 
-func readInitMessage(conn *websocket.Conn) (*InitMessage, error) {
+func readInitMessage(conn streamConn) (*InitMessage, error) {
 	_, initPayload, err := conn.ReadMessage()
 	if err != nil {
 		return nil, errors.New(MsgInitPayloadFailed)
 	}
 
+	return parseInitMessage(initPayload)
+}
+
+func parseInitMessage(initPayload []byte) (*InitMessage, error) {
 	var init InitMessage
 	if err := json.Unmarshal(initPayload, &init); err != nil {
 		return nil, errors.New(MsgInvalidInitJSON)
@@ -332,6 +433,33 @@ func buildContext(init *InitMessage) context.Context {
 	return metadata.NewOutgoingContext(context.Background(), md)
 }
 
+// callContext builds the call context from init, bounded by its timeout
+// and/or deadline (the earlier wins). The returned cancel must be called.
+func callContext(init *InitMessage) (context.Context, context.CancelFunc, error) {
+	ctx := buildContext(init)
+
+	var deadline time.Time
+	if init.Timeout != "" {
+		timeout, err := time.ParseDuration(init.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, nil, fmt.Errorf("%s: %q", MsgInvalidTimeout, init.Timeout)
+		}
+		deadline = time.Now().Add(timeout)
+	}
+
+	if init.Deadline != nil && (deadline.IsZero() || init.Deadline.Before(deadline)) {
+		deadline = *init.Deadline
+	}
+
+	if deadline.IsZero() {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, cancel, nil
+}
+
 func addAuthMetadata(md metadata.MD, auth *AuthConfig) {
 	switch strings.ToLower(auth.Type) {
 	case "bearer":
@@ -343,37 +471,17 @@ func addAuthMetadata(md metadata.MD, auth *AuthConfig) {
 	}
 }
 
-func findMethodDescriptor(init *InitMessage) (*desc.MethodDescriptor, error) {
-	descriptorSetMu.RLock()
-	defer descriptorSetMu.RUnlock()
-
-	for _, file := range descriptorSet.File {
-		for _, svc := range file.GetService() {
-			fullService := fmt.Sprintf("%s.%s", file.GetPackage(), svc.GetName())
-
-			if fullService == init.Service || svc.GetName() == init.Service {
-				if methodDesc := findMethodInService(file, fullService, init.Method); methodDesc != nil {
-					return methodDesc, nil
-				}
-			}
-		}
-	}
-
-	return nil, errors.New(MsgMethodNotFound)
-}
-
-func findMethodInService(file *descriptorpb.FileDescriptorProto, fullService, methodName string) *desc.MethodDescriptor {
-	fileDesc, err := desc.CreateFileDescriptor(file)
-	if err != nil {
-		return nil
+func (ws *Workspace) findMethodDescriptor(init *InitMessage) (*desc.MethodDescriptor, error) {
+	reg := ws.currentRegistry()
+	if reg == nil {
+		return nil, errors.New(MsgNoDescriptorLoaded)
 	}
 
-	sd := fileDesc.FindService(fullService)
-	if sd == nil {
-		return nil
+	if methodDesc := reg.findMethod(init.Service, init.Method); methodDesc != nil {
+		return methodDesc, nil
 	}
 
-	return sd.FindMethodByName(methodName)
+	return nil, errors.New(MsgMethodNotFound)
 }
 
 func determineStreamMode(requestedMode string, methodDesc *desc.MethodDescriptor) StreamMode {
@@ -396,29 +504,62 @@ func inferMode(method *desc.MethodDescriptor) StreamMode {
 	}
 }
 
-func handleStreamMode(ctx context.Context, stub grpcdynamic.Stub, conn *websocket.Conn,
-	methodDesc *desc.MethodDescriptor, mode StreamMode) error {
-
+func handleStreamMode(call *rpcCall, mode StreamMode) error {
 	switch mode {
 	case ModeUnary:
-		return handleUnary(ctx, stub, conn, methodDesc)
+		return handleUnary(call)
 	case ModeServer:
-		return handleServerStream(ctx, stub, conn, methodDesc)
+		return handleServerStream(call)
 	case ModeClient:
-		return handleClientStream(ctx, stub, conn, methodDesc)
+		return handleClientStream(call)
 	case ModeBidi:
-		return handleBidiStream(ctx, stub, conn, methodDesc)
+		return handleBidiStream(call)
 	default:
 		return errors.New(MsgUnknownMode)
 	}
 }
 
-func dialTarget(rawTarget string) (*grpc.ClientConn, error) {
+// dialTarget dials rawTarget. An explicit tlsCfg overrides the transport
+// security inferred from the target; lbPolicy picks the load-balancing
+// policy (pick_first when empty).
+func dialTarget(rawTarget string, tlsCfg *TLSConfig, lbPolicy string) (*grpc.ClientConn, error) {
+	lbOpts, err := loadBalancingOptions(lbPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	target, opts := parseTargetAndCredentials(rawTarget)
-	return grpc.Dial(target, opts)
+
+	if tlsCfg != nil {
+		opts = grpc.WithTransportCredentials(insecure.NewCredentials())
+		if tlsCfg.enabled() {
+			creds, err := buildTLSCredentials(tlsCfg)
+			if err != nil {
+				return nil, err
+			}
+			opts = grpc.WithTransportCredentials(creds)
+		}
+	}
+
+	return grpc.Dial(target, append(lbOpts, opts)...)
 }
 
 func parseTargetAndCredentials(rawTarget string) (string, grpc.DialOption) {
+	target, useTLS := parseTarget(rawTarget)
+	if useTLS {
+		return target, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, ""))
+	}
+
+	return target, grpc.WithTransportCredentials(insecure.NewCredentials())
+}
+
+// parseTarget returns the dial target and whether TLS is implied by it.
+func parseTarget(rawTarget string) (string, bool) {
+	// Handle gRPC target URIs (unix://, dns:///, ipv4:, ...)
+	if target, useTLS, ok := parseSchemeTarget(rawTarget); ok {
+		return target, useTLS
+	}
+
 	// Handle full URLs
 	if strings.HasPrefix(rawTarget, "http://") || strings.HasPrefix(rawTarget, "https://") {
 		return parseURLTarget(rawTarget)
@@ -428,10 +569,10 @@ func parseTargetAndCredentials(rawTarget string) (string, grpc.DialOption) {
 	return parseHostPortTarget(rawTarget)
 }
 
-func parseURLTarget(rawTarget string) (string, grpc.DialOption) {
+func parseURLTarget(rawTarget string) (string, bool) {
 	u, err := url.Parse(rawTarget)
 	if err != nil {
-		return rawTarget, grpc.WithTransportCredentials(insecure.NewCredentials())
+		return rawTarget, false
 	}
 
 	host := u.Host
@@ -443,316 +584,205 @@ func parseURLTarget(rawTarget string) (string, grpc.DialOption) {
 		}
 	}
 
-	if u.Scheme == "https" {
-		return host, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, ""))
-	}
-
-	return host, grpc.WithTransportCredentials(insecure.NewCredentials())
+	return host, u.Scheme == "https"
 }
 
-func parseHostPortTarget(rawTarget string) (string, grpc.DialOption) {
-	if strings.HasSuffix(rawTarget, DefaultPort443) {
-		return rawTarget, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, ""))
-	}
-
-	return rawTarget, grpc.WithTransportCredentials(insecure.NewCredentials())
+func parseHostPortTarget(rawTarget string) (string, bool) {
+	return rawTarget, strings.HasSuffix(rawTarget, DefaultPort443)
 }
 
 // Stream handlers
-func handleUnary(ctx context.Context, stub grpcdynamic.Stub,
-	conn *websocket.Conn, method *desc.MethodDescriptor) error {
-
-	_, msgRaw, err := conn.ReadMessage()
+//
+// Each handler reports the outcome of the RPC itself as header, message,
+// trailer and status frames; a returned error means the call could not be
+// driven at all (e.g. invalid input) and is sent as an error frame.
+func handleUnary(call *rpcCall) error {
+	msgRaw, err := call.readMessage()
 	if err != nil {
-		return errors.New(MsgNoInputMessage)
+		return noInputMessage(call)
 	}
+	call.stopInput()
 
-	reqMsg := dynamic.NewMessage(method.GetInputType())
-	if err := reqMsg.UnmarshalJSON(msgRaw); err != nil {
+	reqMsg, err := unmarshalRequest(call, msgRaw)
+	if err != nil {
 		return fmt.Errorf("%s: %v", MsgInvalidInput, err)
 	}
 
-	resp, err := stub.InvokeRpc(ctx, method, reqMsg)
-	if err != nil {
-		return fmt.Errorf("%s: %v", MsgRPCCallFailed, err)
-	}
+	var header, trailer metadata.MD
+	resp, err := call.stub.InvokeRpc(call.ctx, call.method, reqMsg,
+		grpc.Header(&header), grpc.Trailer(&trailer), grpc.Peer(&call.peer))
 
-	dynResp, ok := resp.(*dynamic.Message)
-	if !ok {
-		return errors.New(MsgUnexpectedResponse)
+	call.sendHeader(header)
+	if err == nil {
+		if err := sendResponse(call, resp); err != nil {
+			return err
+		}
 	}
-
-	data, _ := dynResp.MarshalJSON()
-	return conn.WriteMessage(websocket.TextMessage, data)
+	call.sendTrailer(trailer)
+	return call.sendStatus(err)
 }
 
-func handleServerStream(ctx context.Context, stub grpcdynamic.Stub,
-	conn *websocket.Conn, method *desc.MethodDescriptor) error {
+// noInputMessage ends a call whose request message never came. A deadline
+// or cancel that got there first is the call's status, not an input error.
+func noInputMessage(call *rpcCall) error {
+	if err := call.ctx.Err(); err != nil {
+		return call.sendStatus(status.FromContextError(err).Err())
+	}
+	return errors.New(MsgNoInputMessage)
+}
 
-	_, msgRaw, err := conn.ReadMessage()
+func handleServerStream(call *rpcCall) error {
+	msgRaw, err := call.readMessage()
 	if err != nil {
-		return errors.New(MsgNoInputMessage)
+		return noInputMessage(call)
 	}
+	call.stopInput()
 
-	reqMsg := dynamic.NewMessage(method.GetInputType())
-	if err := reqMsg.UnmarshalJSON(msgRaw); err != nil {
+	reqMsg, err := unmarshalRequest(call, msgRaw)
+	if err != nil {
 		return fmt.Errorf("%s: %v", MsgInvalidInput, err)
 	}
 
-	stream, err := stub.InvokeRpcServerStream(ctx, method, reqMsg)
+	stream, err := call.stub.InvokeRpcServerStream(call.ctx, call.method, reqMsg, grpc.Peer(&call.peer))
 	if err != nil {
-		return fmt.Errorf("%s: %v", MsgStreamFailed, err)
+		return call.sendStatus(err)
 	}
 
-	for {
-		msg, err := stream.RecvMsg()
-		if err != nil {
-			break
-		}
+	header, _ := stream.Header()
+	call.sendHeader(header)
 
-		if dynMsg, ok := msg.(*dynamic.Message); ok {
-			if data, err := dynMsg.MarshalJSON(); err == nil {
-				conn.WriteMessage(websocket.TextMessage, data)
-			}
-		}
-	}
+	err = receiveAll(call, stream.RecvMsg)
 
-	return nil
+	call.sendTrailer(stream.Trailer())
+	return call.sendStatus(err)
 }
 
-func handleClientStream(ctx context.Context, stub grpcdynamic.Stub,
-	conn *websocket.Conn, method *desc.MethodDescriptor) error {
-
-	stream, err := stub.InvokeRpcClientStream(ctx, method)
+// Client and bidi streams send request messages until the client
+// half-closes with {"@control":"half-close"}. A message that does not
+// unmarshal is reported with an error frame and not sent.
+func handleClientStream(call *rpcCall) error {
+	stream, err := call.stub.InvokeRpcClientStream(call.ctx, call.method, grpc.Peer(&call.peer))
 	if err != nil {
-		return fmt.Errorf("%s: %v", MsgStreamFailed, err)
+		return call.sendStatus(err)
 	}
 
 	for {
-		_, msgRaw, err := conn.ReadMessage()
+		msgRaw, err := call.readMessage()
 		if err != nil {
 			break
 		}
 
-		if shouldEndClientStream(msgRaw) {
-			break
-		}
-
-		reqMsg := dynamic.NewMessage(method.GetInputType())
-		if err := reqMsg.UnmarshalJSON(msgRaw); err != nil {
-			continue // Skip invalid messages
+		reqMsg, err := unmarshalRequest(call, msgRaw)
+		if err != nil {
+			call.sendError(MsgUnmarshalFailed, err.Error())
+			continue
 		}
 
+		// A failed send means the server already finished the call; its
+		// status is reported by CloseAndReceive below.
 		if err := stream.SendMsg(reqMsg); err != nil {
-			return fmt.Errorf("%s: %v", MsgSendMsgFailed, err)
+			break
 		}
 	}
 
-	resp, err := stream.CloseAndReceive()
-	if err != nil {
-		return fmt.Errorf("%s: %v", MsgCloseStreamFailed, err)
-	}
-
-	if dynResp, ok := resp.(*dynamic.Message); ok {
-		data, _ := dynResp.MarshalJSON()
-		conn.WriteMessage(websocket.TextMessage, data)
-	}
-
-	return nil
-}
+	call.stopInput()
 
-func shouldEndClientStream(msgRaw []byte) bool {
-	var generic map[string]interface{}
-	if err := json.Unmarshal(msgRaw, &generic); err != nil {
-		return false
-	}
+	resp, err := stream.CloseAndReceive()
 
-	if val, ok := generic["end"].(bool); ok && val {
-		return true
+	header, _ := stream.Header()
+	call.sendHeader(header)
+	if err == nil {
+		if err := sendResponse(call, resp); err != nil {
+			return err
+		}
 	}
-
-	return false
+	call.sendTrailer(stream.Trailer())
+	return call.sendStatus(err)
 }
 
-func handleBidiStream(ctx context.Context, stub grpcdynamic.Stub,
-	conn *websocket.Conn, method *desc.MethodDescriptor) error {
-
-	stream, err := stub.InvokeRpcBidiStream(ctx, method)
+func handleBidiStream(call *rpcCall) error {
+	stream, err := call.stub.InvokeRpcBidiStream(call.ctx, call.method, grpc.Peer(&call.peer))
 	if err != nil {
-		return fmt.Errorf("%s: %v", MsgBidiStreamFailed, err)
+		return call.sendStatus(err)
 	}
 
-	done := make(chan struct{})
-	errChan := make(chan error, 2)
-
 	// Reader goroutine
 	go func() {
 		defer stream.CloseSend()
+		defer call.stopInput()
 
 		for {
-			_, msgRaw, err := conn.ReadMessage()
-			if err != nil || string(msgRaw) == EndSignal {
+			msgRaw, err := call.readMessage()
+			if err != nil {
 				break
 			}
 
-			reqMsg := dynamic.NewMessage(method.GetInputType())
-			if err := reqMsg.UnmarshalJSON(msgRaw); err == nil {
-				if err := stream.SendMsg(reqMsg); err != nil {
-					errChan <- err
-					break
-				}
-			}
-		}
-	}()
-
-	// Writer goroutine
-	go func() {
-		defer close(done)
-
-		for {
-			msg, err := stream.RecvMsg()
+			reqMsg, err := unmarshalRequest(call, msgRaw)
 			if err != nil {
-				break
+				call.sendError(MsgUnmarshalFailed, err.Error())
+				continue
 			}
 
-			if dynMsg, ok := msg.(*dynamic.Message); ok {
-				if data, err := dynMsg.MarshalJSON(); err == nil {
-					if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-						errChan <- err
-						break
-					}
-				}
+			if err := stream.SendMsg(reqMsg); err != nil {
+				break
 			}
 		}
 	}()
 
-	select {
-	case err := <-errChan:
-		return err
-	case <-done:
-		return nil
-	}
-}
-
-// Protocol buffer compiler installation
-func installProtocIfMissing() (string, error) {
-	if protocPath, err := exec.LookPath("protoc"); err == nil {
-		return protocPath, nil
-	}
-
-	osName, err := getOSName()
-	if err != nil {
-		return "", err
-	}
-
-	return downloadAndInstallProtoc(osName)
-}
+	// Responses are received here until the server ends the call.
+	header, _ := stream.Header()
+	call.sendHeader(header)
 
-func getOSName() (string, error) {
-	switch runtime.GOOS {
-	case "windows":
-		return "win64", nil
-	case "darwin":
-		return "osx-x86_64", nil
-	case "linux":
-		return "linux-x86_64", nil
-	default:
-		return "", fmt.Errorf(MsgUnsupportedOS, runtime.GOOS)
-	}
-}
-
-func downloadAndInstallProtoc(osName string) (string, error) {
-	url := buildProtocDownloadURL(osName)
-
-	tmpDir := filepath.Join(os.TempDir(), ".protoc")
-	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		return "", err
-	}
+	err = receiveAll(call, stream.RecvMsg)
 
-	zipPath, err := downloadProtoc(url, tmpDir, osName)
-	if err != nil {
-		return "", err
-	}
-
-	return extractProtoc(zipPath, tmpDir)
+	call.sendTrailer(stream.Trailer())
+	return call.sendStatus(err)
 }
 
-func buildProtocDownloadURL(osName string) string {
-	filename := fmt.Sprintf("protoc-%s-%s.zip", DefaultProtocVersion, osName)
-	return fmt.Sprintf("https://github.com/protocolbuffers/protobuf/releases/download/v%s/%s",
-		DefaultProtocVersion, filename)
+// newDynamicStub returns a stub whose responses are always dynamic messages.
+// The default one hands back generated types for well-known responses such
+// as google.protobuf.Empty, which sendResponse cannot encode.
+func newDynamicStub(cc *grpc.ClientConn) grpcdynamic.Stub {
+	mf := dynamic.NewMessageFactoryWithKnownTypeRegistry(dynamic.NewKnownTypeRegistryWithoutWellKnownTypes())
+	return grpcdynamic.NewStubWithMessageFactory(cc, mf)
 }
 
-func downloadProtoc(url, tmpDir, osName string) (string, error) {
-	filename := fmt.Sprintf("protoc-%s-%s.zip", DefaultProtocVersion, osName)
-	zipPath := filepath.Join(tmpDir, filename)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(zipPath)
-	if err != nil {
-		return "", err
-	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		return "", err
+func unmarshalRequest(call *rpcCall, msgRaw []byte) (*dynamic.Message, error) {
+	reqMsg := dynamic.NewMessage(call.method.GetInputType())
+	if err := call.input.decodeMessage(reqMsg, msgRaw, call.registry.resolver()); err != nil {
+		return nil, err
 	}
-
-	return zipPath, nil
+	return reqMsg, nil
 }
 
-func extractProtoc(zipPath, tmpDir string) (string, error) {
-	r, err := zip.OpenReader(zipPath)
-	if err != nil {
-		return "", err
-	}
-	defer r.Close()
-
-	installDir := filepath.Join(tmpDir, "protoc")
-	os.RemoveAll(installDir) // Clean before extraction
-
-	for _, f := range r.File {
-		if err := extractFile(f, installDir); err != nil {
-			return "", err
+// receiveAll forwards every message from recv as a message frame until the
+// stream ends. It returns nil on a clean end of stream, or the RPC error.
+func receiveAll(call *rpcCall, recv func() (protoiface.MessageV1, error)) error {
+	for {
+		msg, err := recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
-	}
 
-	protocExecutable := filepath.Join(installDir, "bin", "protoc")
-	if runtime.GOOS == "windows" {
-		protocExecutable += ".exe"
+		if err := sendResponse(call, msg); err != nil {
+			return err
+		}
 	}
-
-	return protocExecutable, nil
 }
 
-func extractFile(f *zip.File, installDir string) error {
-	fpath := filepath.Join(installDir, f.Name)
-
-	if f.FileInfo().IsDir() {
-		return os.MkdirAll(fpath, 0755)
-	}
-
-	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
-		return err
-	}
-
-	rc, err := f.Open()
-	if err != nil {
-		return err
+func sendResponse(call *rpcCall, resp protoiface.MessageV1) error {
+	dynResp, ok := resp.(*dynamic.Message)
+	if !ok {
+		return errors.New(MsgUnexpectedResponse)
 	}
-	defer rc.Close()
 
-	dest, err := os.Create(fpath)
+	data, err := call.output.encodeMessage(dynResp, call.jsonOpts, call.registry.resolver())
 	if err != nil {
 		return err
 	}
-	defer dest.Close()
 
-	_, err = io.Copy(dest, rc)
-	return err
+	return call.sendMessage(data)
 }
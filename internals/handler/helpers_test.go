@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// startHealthServer serves grpc.health.v1.Health on a loopback port, with
+// the service "svc" reported as NOT_SERVING, and returns its address.
+func startHealthServer(t *testing.T, opts ...grpc.ServerOption) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer(opts...)
+	hs := health.NewServer()
+	hs.SetServingStatus("svc", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// useTempWorkspaceRoot makes the test's workspaces, including any a handler
+// creates, live under a directory removed when the test ends.
+func useTempWorkspaceRoot(t *testing.T) {
+	t.Setenv(WorkspaceDirEnv, t.TempDir())
+}
+
+// newWorkspace returns an empty workspace under a temporary root.
+func newWorkspace(t *testing.T) *Workspace {
+	t.Helper()
+
+	useTempWorkspaceRoot(t)
+	ws, err := createWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { deleteWorkspace(ws.ID) })
+	return ws
+}
+
+// newHealthWorkspace returns a workspace with the health service loaded.
+func newHealthWorkspace(t *testing.T) *Workspace {
+	t.Helper()
+
+	ws := newWorkspace(t)
+	fds := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	if err := ws.setDescriptorSet(fds); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+// newProtoWorkspace returns a workspace with the given proto file compiled
+// and loaded.
+func newProtoWorkspace(t *testing.T, name, src string) *Workspace {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fds, _, err := compileProtoFiles(context.Background(), []string{dir}, []string{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws := newWorkspace(t)
+	if err := ws.setDescriptorSet(fds); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
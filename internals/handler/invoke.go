@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Log messages as variables
+var (
+	MsgInvalidInvokeJSON = "Invalid invoke request JSON"
+	MsgNotUnaryMethod    = "Method is not unary; use the WebSocket stream"
+)
+
+// InvokeRequest is the body of a REST invocation. Service and method come
+// from the URL; request is the request message in the input encoding.
+type InvokeRequest struct {
+	InitMessage
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// InvokeResult is everything a unary call produced, in one document.
+type InvokeResult struct {
+	Response json.RawMessage `json:"response,omitempty"`
+	Headers  metadata.MD     `json:"headers"`
+	Trailers metadata.MD     `json:"trailers"`
+	Status   *RPCStatus      `json:"status"`
+	Peer     string          `json:"peer,omitempty"`
+	Timing   InvokeTiming    `json:"timing"`
+}
+
+// InvokeTiming breaks down where the time of an invocation went.
+type InvokeTiming struct {
+	StartedAt time.Time `json:"startedAt"`
+	ConnectMs float64   `json:"connectMs"` // acquiring a (possibly pooled) connection
+	CallMs    float64   `json:"callMs"`    // the RPC itself
+	TotalMs   float64   `json:"totalMs"`
+}
+
+// InvokeError is a problem on our side that kept the call from running,
+// with the HTTP status to report it with.
+type InvokeError struct {
+	Status  int
+	Message string
+	Details string
+}
+
+func (e *InvokeError) Error() string {
+	if e.Details == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.Details)
+}
+
+// REST invoke handler
+func HandleInvoke(c *gin.Context) {
+	var req InvokeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidInvokeJSON, "details": err.Error()})
+		return
+	}
+
+	req.Service = c.Param("service")
+	req.Method = c.Param("method")
+	if req.Workspace == "" {
+		req.Workspace = workspaceIDFromRequest(c)
+	}
+
+	result, err := invokeUnary(&req.InitMessage, req.Request)
+	if err != nil {
+		var invokeErr *InvokeError
+		if errors.As(err, &invokeErr) {
+			c.JSON(invokeErr.Status, gin.H{"error": invokeErr.Message, "details": invokeErr.Details})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := marshalFrame(result, req.JSON.indent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// invokeUnary runs the unary call described by init with request reqRaw,
+// in init's input encoding (an empty message when omitted). The gRPC
+// outcome, failed or not, is part of the result; an error means the call
+// could not be made.
+func invokeUnary(init *InitMessage, reqRaw json.RawMessage) (*InvokeResult, error) {
+	ws, err := lookupWorkspace(init.Workspace)
+	if err != nil {
+		return nil, &InvokeError{Status: http.StatusNotFound, Message: MsgWorkspaceNotFound}
+	}
+
+	if err := validateEncodings(init); err != nil {
+		return nil, &InvokeError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	methodDesc, err := ws.findMethodDescriptor(init)
+	if err != nil {
+		return nil, &InvokeError{Status: http.StatusNotFound, Message: err.Error()}
+	}
+
+	if methodDesc.IsClientStreaming() || methodDesc.IsServerStreaming() {
+		return nil, &InvokeError{Status: http.StatusBadRequest, Message: MsgNotUnaryMethod}
+	}
+
+	reg := ws.currentRegistry()
+	reqMsg := dynamic.NewMessage(methodDesc.GetInputType())
+	if len(reqRaw) > 0 {
+		if err := init.InputEncoding.decodeMessage(reqMsg, reqRaw, reg.resolver()); err != nil {
+			return nil, &InvokeError{Status: http.StatusBadRequest, Message: MsgInvalidInput, Details: err.Error()}
+		}
+	}
+
+	ctx, cancel, err := callContext(init)
+	if err != nil {
+		return nil, &InvokeError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	defer cancel()
+
+	result := &InvokeResult{Timing: InvokeTiming{StartedAt: time.Now()}}
+
+	pooled, err := acquireConn(init.Target, init.TLS, init.LBPolicy)
+	if err != nil {
+		return nil, &InvokeError{Status: http.StatusBadGateway, Message: MsgDialTargetFailed, Details: err.Error()}
+	}
+	defer pooled.release()
+
+	connected := time.Now()
+
+	var callPeer peer.Peer
+	resp, err := newDynamicStub(pooled.cc).InvokeRpc(ctx, methodDesc, reqMsg,
+		grpc.Header(&result.Headers), grpc.Trailer(&result.Trailers), grpc.Peer(&callPeer))
+
+	done := time.Now()
+	result.Timing.ConnectMs = milliseconds(connected.Sub(result.Timing.StartedAt))
+	result.Timing.CallMs = milliseconds(done.Sub(connected))
+	result.Timing.TotalMs = milliseconds(done.Sub(result.Timing.StartedAt))
+
+	result.Status = statusFromError(err, reg.resolver())
+	result.Peer = peerAddress(&callPeer)
+	if result.Headers == nil {
+		result.Headers = metadata.MD{}
+	}
+	if result.Trailers == nil {
+		result.Trailers = metadata.MD{}
+	}
+
+	if err == nil {
+		dynResp, ok := resp.(*dynamic.Message)
+		if !ok {
+			return nil, errors.New(MsgUnexpectedResponse)
+		}
+		if result.Response, err = init.OutputEncoding.encodeMessage(dynResp, init.JSON, reg.resolver()); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// JSONOptions control how response messages are rendered. The zero value
+// is proto3 JSON as dynamic.Message.MarshalJSON writes it.
+type JSONOptions struct {
+	EmitUnpopulated bool   `json:"emitUnpopulated,omitempty"` // include zero-valued fields
+	UseProtoNames   bool   `json:"useProtoNames,omitempty"`   // snake_case field names from the .proto
+	EnumsAsInts     bool   `json:"enumsAsInts,omitempty"`
+	Indent          string `json:"indent,omitempty"`        // indents whole frames, e.g. "  "
+	Int64AsNumber   bool   `json:"int64AsNumber,omitempty"` // 64-bit integers as JSON numbers, not strings
+}
+
+// marshalMessage renders msg as JSON according to opts, which may be nil,
+// expanding Any values with resolver. Indent is left to the writer, which
+// indents the whole frame.
+func (opts *JSONOptions) marshalMessage(msg *dynamic.Message, resolver *typeResolver) ([]byte, error) {
+	if opts == nil {
+		opts = &JSONOptions{}
+	}
+
+	data, err := msg.MarshalJSONPB(&jsonpb.Marshaler{
+		OrigName:     opts.UseProtoNames,
+		EnumsAsInts:  opts.EnumsAsInts,
+		EmitDefaults: opts.EmitUnpopulated,
+		AnyResolver:  resolver,
+	})
+	if err != nil || !opts.Int64AsNumber {
+		return data, err
+	}
+
+	return int64sAsNumbers(data, msg.GetMessageDescriptor(), resolver)
+}
+
+func (opts *JSONOptions) indent() string {
+	if opts == nil {
+		return ""
+	}
+	return opts.Indent
+}
+
+// marshalFrame encodes v, indented if indent is set.
+func marshalFrame(v interface{}, indent string) ([]byte, error) {
+	if indent == "" {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, "", indent)
+}
+
+// int64sAsNumbers rewrites the 64-bit integer fields of md in data, which
+// proto3 JSON writes as strings, as plain numbers. The descriptor tells
+// which strings are integers, and resolver the type of each expanded Any;
+// everything else, key order included, is kept.
+func int64sAsNumbers(data []byte, md *desc.MessageDescriptor, resolver *typeResolver) ([]byte, error) {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return unquoteInteger(data), nil
+	case "google.protobuf.Any":
+		return anyInt64sAsNumbers(data, resolver)
+	}
+
+	return rewriteObjectJSON(data, func(key string, value []byte) ([]byte, error) {
+		return rewriteMemberJSON(key, value, md, resolver)
+	})
+}
+
+// anyInt64sAsNumbers rewrites an expanded Any as the type its @type names.
+// Well-known types with a special JSON form are nested under "value"; other
+// messages have their fields beside @type. Unknown types are kept as is.
+func anyInt64sAsNumbers(data []byte, resolver *typeResolver) ([]byte, error) {
+	var probe struct {
+		Type string `json:"@type"`
+	}
+	if json.Unmarshal(data, &probe) != nil || probe.Type == "" {
+		return data, nil
+	}
+
+	md := resolver.findDescriptor(typeNameFromURL(probe.Type))
+	if md == nil {
+		return data, nil
+	}
+	_, special := wellKnownJSONSchemas[md.GetFullyQualifiedName()]
+
+	return rewriteObjectJSON(data, func(key string, value []byte) ([]byte, error) {
+		switch {
+		case !special:
+			return rewriteMemberJSON(key, value, md, resolver)
+		case key == "value":
+			return int64sAsNumbers(value, md, resolver)
+		default:
+			return value, nil
+		}
+	})
+}
+
+// rewriteMemberJSON rewrites the value of the field of md named key, by its
+// JSON or original name. Keys that name no field (@type) are kept.
+func rewriteMemberJSON(key string, value []byte, md *desc.MessageDescriptor, resolver *typeResolver) ([]byte, error) {
+	fd := md.FindFieldByJSONName(key)
+	if fd == nil {
+		fd = md.FindFieldByName(key)
+	}
+	if fd == nil {
+		return value, nil
+	}
+	return rewriteFieldJSON(value, fd, resolver)
+}
+
+func rewriteFieldJSON(data []byte, fd *desc.FieldDescriptor, resolver *typeResolver) ([]byte, error) {
+	switch {
+	case fd.IsMap():
+		valueFd := fd.GetMapValueType()
+		return rewriteObjectJSON(data, func(_ string, value []byte) ([]byte, error) {
+			return rewriteValueJSON(value, valueFd, resolver)
+		})
+	case fd.IsRepeated():
+		return rewriteArrayJSON(data, func(elem []byte) ([]byte, error) {
+			return rewriteValueJSON(elem, fd, resolver)
+		})
+	default:
+		return rewriteValueJSON(data, fd, resolver)
+	}
+}
+
+func rewriteValueJSON(data []byte, fd *desc.FieldDescriptor, resolver *typeResolver) ([]byte, error) {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return unquoteInteger(data), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return int64sAsNumbers(data, fd.GetMessageType(), resolver)
+	default:
+		return data, nil
+	}
+}
+
+// unquoteInteger turns "123" into 123; anything else is returned as is.
+func unquoteInteger(data []byte) []byte {
+	var s string
+	if json.Unmarshal(data, &s) != nil {
+		return data
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+		if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+			return data
+		}
+	}
+	return []byte(s)
+}
+
+// rewriteObjectJSON rebuilds a JSON object with each value passed through
+// fn, keeping key order. Non-objects (e.g. null) are returned as is.
+func rewriteObjectJSON(data []byte, fn func(key string, value []byte) ([]byte, error)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return data, nil
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if value, err = fn(key, value); err != nil {
+			return nil, err
+		}
+
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		keyJSON, _ := json.Marshal(key)
+		out.Write(keyJSON)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+
+	return out.Bytes(), nil
+}
+
+func rewriteArrayJSON(data []byte, fn func(elem []byte) ([]byte, error)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return data, nil
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('[')
+	for dec.More() {
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return nil, err
+		}
+
+		elem, err := fn(elem)
+		if err != nil {
+			return nil, err
+		}
+
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		out.Write(elem)
+	}
+	out.WriteByte(']')
+
+	return out.Bytes(), nil
+}
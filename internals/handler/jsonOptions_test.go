@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+const wrapProto = `syntax = "proto3";
+package wrap;
+
+import "google/protobuf/any.proto";
+
+message Envelope {
+  google.protobuf.Any payload = 1;
+  repeated google.protobuf.Any items = 2;
+  int64 id = 3;
+}
+
+message Inner {
+  int64 count = 1;
+}
+`
+
+func TestInt64AsNumberInsideAny(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "wrap.proto"), []byte(wrapProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fds, _, err := compileProtoFiles(context.Background(), []string{dir}, []string{"wrap.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := newDescriptorRegistry(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := `{"payload":{"@type":"type.googleapis.com/wrap.Inner","count":"42"},` +
+		`"items":[{"@type":"type.googleapis.com/google.protobuf.Int64Value","value":"5"},` +
+		`{"@type":"type.googleapis.com/google.protobuf.Duration","value":"3s"}],` +
+		`"id":"7"}`
+	want := `{"payload":{"@type":"type.googleapis.com/wrap.Inner","count":42},` +
+		`"items":[{"@type":"type.googleapis.com/google.protobuf.Int64Value","value":5},` +
+		`{"@type":"type.googleapis.com/google.protobuf.Duration","value":"3s"}],` +
+		`"id":7}`
+
+	msg := dynamic.NewMessage(reg.findMessage("wrap.Envelope"))
+	if err := EncodingJSON.decodeMessage(msg, []byte(in), reg.resolver()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := EncodingJSON.encodeMessage(msg, &JSONOptions{Int64AsNumber: true}, reg.resolver())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
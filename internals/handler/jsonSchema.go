@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Log messages as variables
+var (
+	MsgMessageNotFound = "Message type not found"
+)
+
+// jsonSchema is one JSON Schema node.
+type jsonSchema map[string]interface{}
+
+// Patterns for values proto3 JSON encodes as strings
+const (
+	patternInteger  = `^-?[0-9]+$`
+	patternUnsigned = `^[0-9]+$`
+	patternDuration = `^-?[0-9]+(\.[0-9]{1,9})?s$`
+)
+
+// Schemas of the well-known types that have a special proto3 JSON form.
+var wellKnownJSONSchemas = map[string]jsonSchema{
+	"google.protobuf.Timestamp": {"type": "string", "format": "date-time"},
+	"google.protobuf.Duration":  {"type": "string", "pattern": patternDuration},
+	"google.protobuf.FieldMask": {"type": "string", "description": "Comma-separated lowerCamelCase field paths"},
+	"google.protobuf.Struct":    {"type": "object"},
+	"google.protobuf.ListValue": {"type": "array"},
+	"google.protobuf.Value":     {},
+	"google.protobuf.Any": {
+		"type":       "object",
+		"properties": jsonSchema{"@type": jsonSchema{"type": "string"}},
+		"required":   []string{"@type"},
+	},
+	"google.protobuf.DoubleValue": floatJSONSchema(),
+	"google.protobuf.FloatValue":  floatJSONSchema(),
+	"google.protobuf.Int64Value":  {"type": []string{"string", "integer"}, "pattern": patternInteger},
+	"google.protobuf.UInt64Value": {"type": []string{"string", "integer"}, "pattern": patternUnsigned, "minimum": 0},
+	"google.protobuf.Int32Value":  {"type": "integer", "minimum": -2147483648, "maximum": 2147483647},
+	"google.protobuf.UInt32Value": {"type": "integer", "minimum": 0, "maximum": 4294967295},
+	"google.protobuf.BoolValue":   {"type": "boolean"},
+	"google.protobuf.StringValue": {"type": "string"},
+	"google.protobuf.BytesValue":  {"type": "string", "contentEncoding": "base64"},
+}
+
+// JSON Schema handler. Produces a draft 2020-12 schema for a message type
+// that follows the proto3 JSON mapping. Every message and enum reached is a
+// $defs entry, so recursive types are plain $refs.
+func HandleJSONSchema(c *gin.Context) {
+	reg := registryFromRequest(c)
+	if reg == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoDescriptorLoaded})
+		return
+	}
+
+	md := reg.findMessage(strings.TrimPrefix(c.Param("message"), "."))
+	if md == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgMessageNotFound})
+		return
+	}
+
+	c.JSON(http.StatusOK, messageJSONSchema(md))
+}
+
+func messageJSONSchema(md *desc.MessageDescriptor) jsonSchema {
+	b := &jsonSchemaBuilder{defs: make(jsonSchema)}
+	root := b.messageRef(md)
+
+	root["$schema"] = JSONSchemaDraft
+	root["$defs"] = b.defs
+	return root
+}
+
+type jsonSchemaBuilder struct {
+	defs jsonSchema
+}
+
+// messageRef returns a schema referring to md, adding its definition first.
+func (b *jsonSchemaBuilder) messageRef(md *desc.MessageDescriptor) jsonSchema {
+	name := md.GetFullyQualifiedName()
+	if wkt, ok := wellKnownJSONSchemas[name]; ok {
+		return copyJSONSchema(wkt)
+	}
+
+	if _, seen := b.defs[name]; !seen {
+		b.defs[name] = jsonSchema{} // placeholder, ends recursion
+		b.defs[name] = b.messageDef(md)
+	}
+	return jsonSchema{"$ref": "#/$defs/" + name}
+}
+
+func (b *jsonSchemaBuilder) enumRef(ed *desc.EnumDescriptor) jsonSchema {
+	name := ed.GetFullyQualifiedName()
+	if name == "google.protobuf.NullValue" {
+		return jsonSchema{"type": "null"}
+	}
+
+	if _, seen := b.defs[name]; !seen {
+		names := make([]string, 0, len(ed.GetValues()))
+		for _, vd := range ed.GetValues() {
+			names = append(names, vd.GetName())
+		}
+
+		def := jsonSchema{"type": "string", "enum": names}
+		describe(def, ed)
+		b.defs[name] = def
+	}
+	return jsonSchema{"$ref": "#/$defs/" + name}
+}
+
+// messageDef describes md as an object. Fields are keyed by their JSON
+// name; the original field name is accepted too, as parsers do, but not
+// both at once. Oneof members are mutually exclusive.
+func (b *jsonSchemaBuilder) messageDef(md *desc.MessageDescriptor) jsonSchema {
+	properties := make(jsonSchema)
+	dependent := make(jsonSchema)
+	var required []string
+
+	for _, fd := range md.GetFields() {
+		schema := b.fieldSchema(fd)
+		describe(schema, fd)
+
+		properties[fd.GetJSONName()] = schema
+		if fd.GetName() != fd.GetJSONName() {
+			properties[fd.GetName()] = schema
+			dependent[fd.GetName()] = jsonSchema{"not": jsonSchema{"required": []string{fd.GetJSONName()}}}
+		}
+
+		if fd.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+			required = append(required, fd.GetJSONName())
+		}
+	}
+
+	def := jsonSchema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	describe(def, md)
+
+	if len(required) > 0 {
+		def["required"] = required
+	}
+	if len(dependent) > 0 {
+		def["dependentSchemas"] = dependent
+	}
+
+	var exclusive []jsonSchema
+	for _, od := range md.GetOneOfs() {
+		if !od.IsSynthetic() && len(od.GetChoices()) > 1 {
+			exclusive = append(exclusive, oneofJSONSchema(od))
+		}
+	}
+	if len(exclusive) > 0 {
+		def["allOf"] = exclusive
+	}
+
+	return def
+}
+
+// oneofJSONSchema allows at most one member of od to be set.
+func oneofJSONSchema(od *desc.OneOfDescriptor) jsonSchema {
+	present := make([]jsonSchema, 0, len(od.GetChoices()))
+	for _, fd := range od.GetChoices() {
+		present = append(present, fieldPresence(fd))
+	}
+
+	return jsonSchema{"oneOf": append(present, jsonSchema{"not": jsonSchema{"anyOf": present}})}
+}
+
+func fieldPresence(fd *desc.FieldDescriptor) jsonSchema {
+	if fd.GetName() == fd.GetJSONName() {
+		return jsonSchema{"required": []string{fd.GetJSONName()}}
+	}
+	return jsonSchema{"anyOf": []jsonSchema{
+		{"required": []string{fd.GetJSONName()}},
+		{"required": []string{fd.GetName()}},
+	}}
+}
+
+func (b *jsonSchemaBuilder) fieldSchema(fd *desc.FieldDescriptor) jsonSchema {
+	if fd.IsMap() {
+		return jsonSchema{
+			"type":                 "object",
+			"propertyNames":        mapKeyJSONSchema(fd.GetMapKeyType()),
+			"additionalProperties": b.singularSchema(fd.GetMapValueType()),
+		}
+	}
+
+	if fd.IsRepeated() {
+		return jsonSchema{"type": "array", "items": b.singularSchema(fd)}
+	}
+
+	return b.singularSchema(fd)
+}
+
+func (b *jsonSchemaBuilder) singularSchema(fd *desc.FieldDescriptor) jsonSchema {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return b.messageRef(fd.GetMessageType())
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return b.enumRef(fd.GetEnumType())
+	default:
+		return scalarJSONSchema(fd.GetType())
+	}
+}
+
+func scalarJSONSchema(t descriptorpb.FieldDescriptorProto_Type) jsonSchema {
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return jsonSchema{"type": "integer", "minimum": -2147483648, "maximum": 2147483647}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return jsonSchema{"type": "integer", "minimum": 0, "maximum": 4294967295}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		// Written as strings; parsers accept numbers too.
+		return jsonSchema{"type": []string{"string", "integer"}, "pattern": patternInteger}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return jsonSchema{"type": []string{"string", "integer"}, "pattern": patternUnsigned, "minimum": 0}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+		descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return floatJSONSchema()
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return jsonSchema{"type": "boolean"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return jsonSchema{"type": "string", "contentEncoding": "base64"}
+	default:
+		return jsonSchema{"type": "string"}
+	}
+}
+
+// floatJSONSchema accepts numbers and the special values proto3 JSON
+// writes as strings.
+func floatJSONSchema() jsonSchema {
+	return jsonSchema{"anyOf": []jsonSchema{
+		{"type": "number"},
+		{"enum": []string{"NaN", "Infinity", "-Infinity"}},
+	}}
+}
+
+// mapKeyJSONSchema constrains map keys, which JSON always writes as strings.
+func mapKeyJSONSchema(fd *desc.FieldDescriptor) jsonSchema {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return jsonSchema{"enum": []string{"true", "false"}}
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return jsonSchema{"type": "string"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return jsonSchema{"type": "string", "pattern": patternUnsigned}
+	default:
+		return jsonSchema{"type": "string", "pattern": patternInteger}
+	}
+}
+
+// describe sets the schema's description from d's leading comments.
+func describe(schema jsonSchema, d desc.Descriptor) {
+	if comments := leadingComments(d); comments != "" {
+		schema["description"] = comments
+	}
+}
+
+func copyJSONSchema(schema jsonSchema) jsonSchema {
+	dup := make(jsonSchema, len(schema))
+	for k, v := range schema {
+		dup[k] = v
+	}
+	return dup
+}
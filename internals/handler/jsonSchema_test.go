@@ -0,0 +1,369 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// contactProto adds a oneof next to the example server's user.proto.
+const contactProto = `syntax = "proto3";
+package userservice;
+
+import "user.proto";
+
+message Contact {
+  oneof via {
+    string email = 1;
+    string phone_number = 2;
+    User user = 3;
+  }
+}
+`
+
+func compileExampleRegistry(t *testing.T) *descriptorRegistry {
+	t.Helper()
+
+	src, err := os.ReadFile(filepath.Join("..", "..", "grpcExampleServer", "user.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"user.proto": src, "contact.proto": []byte(contactProto)} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outPath := filepath.Join(t.TempDir(), "out.pb")
+	if _, _, err := compileProtoTree(context.Background(), dir, outPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := parseDescriptorSet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := newDescriptorRegistry(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// schemaFor returns the schema of a message as a client would decode it.
+func schemaFor(t *testing.T, reg *descriptorRegistry, name string) map[string]interface{} {
+	t.Helper()
+
+	md := reg.findMessage(name)
+	if md == nil {
+		t.Fatalf("message %s not found", name)
+	}
+
+	data, err := json.Marshal(messageJSONSchema(md))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// def returns the $defs entry the schema's $ref points at, or the schema.
+func def(schema map[string]interface{}, root map[string]interface{}) map[string]interface{} {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema
+	}
+	return root["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{})
+}
+
+func property(t *testing.T, root map[string]interface{}, path ...string) map[string]interface{} {
+	t.Helper()
+
+	schema := def(root, root)
+	for _, name := range path {
+		props, _ := schema["properties"].(map[string]interface{})
+		next, ok := props[name].(map[string]interface{})
+		if !ok {
+			t.Fatalf("no property %s", strings.Join(path, "."))
+		}
+		schema = next
+	}
+	return schema
+}
+
+func TestMessageJSONSchema(t *testing.T) {
+	reg := compileExampleRegistry(t)
+
+	t.Run("int64 as string", func(t *testing.T) {
+		root := schemaFor(t, reg, "userservice.FileChunk")
+		chunk := property(t, root, "chunkNumber")
+		if fmt.Sprint(chunk["type"]) != "[string integer]" || chunk["pattern"] != patternInteger {
+			t.Fatalf("chunkNumber: %v", chunk)
+		}
+	})
+
+	t.Run("enum names", func(t *testing.T) {
+		root := schemaFor(t, reg, "userservice.User")
+		role := def(property(t, root, "role"), root)
+		want := []interface{}{"USER_ROLE_UNSPECIFIED", "USER_ROLE_ADMIN", "USER_ROLE_USER", "USER_ROLE_MODERATOR"}
+		if role["type"] != "string" || !slices.Equal(role["enum"].([]interface{}), want) {
+			t.Fatalf("role: %v", role)
+		}
+	})
+
+	t.Run("well-known types", func(t *testing.T) {
+		root := schemaFor(t, reg, "userservice.User")
+		createdAt := property(t, root, "createdAt")
+		if createdAt["type"] != "string" || createdAt["format"] != "date-time" {
+			t.Fatalf("createdAt: %v", createdAt)
+		}
+
+		empty := schemaFor(t, reg, "google.protobuf.Empty")
+		if props := def(empty, empty)["properties"].(map[string]interface{}); len(props) != 0 {
+			t.Fatalf("Empty has properties: %v", props)
+		}
+	})
+
+	t.Run("metadata map", func(t *testing.T) {
+		root := schemaFor(t, reg, "userservice.User")
+		metadata := property(t, root, "metadata")
+		values, _ := metadata["additionalProperties"].(map[string]interface{})
+		if metadata["type"] != "object" || values["type"] != "string" {
+			t.Fatalf("metadata: %v", metadata)
+		}
+	})
+
+	t.Run("original field names", func(t *testing.T) {
+		root := schemaFor(t, reg, "userservice.User")
+		property(t, root, "firstName")
+		property(t, root, "first_name")
+	})
+
+	t.Run("oneof", func(t *testing.T) {
+		root := schemaFor(t, reg, "userservice.Contact")
+		allOf, _ := def(root, root)["allOf"].([]interface{})
+		if len(allOf) != 1 {
+			t.Fatalf("allOf: %v", allOf)
+		}
+	})
+}
+
+func TestMessageJSONSchemaValidatesPayloads(t *testing.T) {
+	reg := compileExampleRegistry(t)
+
+	tests := []struct {
+		message string
+		payload string
+		valid   bool
+	}{
+		{"userservice.User", `{}`, true},
+		{"userservice.User", `{"id":"1","role":"USER_ROLE_ADMIN","createdAt":"2024-01-02T03:04:05Z","isActive":true,"metadata":{"team":"core"}}`, true},
+		{"userservice.User", `{"first_name":"Ada","lastName":"Lovelace"}`, true},
+		{"userservice.User", `{"role":"ADMIN"}`, false},
+		{"userservice.User", `{"createdAt":1700000000}`, false},
+		{"userservice.User", `{"metadata":{"team":1}}`, false},
+		{"userservice.User", `{"nickname":"ada"}`, false},
+		{"userservice.User", `{"firstName":"Ada","first_name":"Ada"}`, false},
+		{"userservice.FileChunk", `{"chunkNumber":"42","totalChunks":42,"data":"aGk="}`, true},
+		{"userservice.FileChunk", `{"chunkNumber":"4x2"}`, false},
+		{"userservice.FileChunk", `{"chunkNumber":4.5}`, false},
+		{"userservice.ListUsersRequest", `{"pageSize":2147483648}`, false},
+		{"userservice.Contact", `{"email":"ada@example.com"}`, true},
+		{"userservice.Contact", `{"phone_number":"555"}`, true},
+		{"userservice.Contact", `{"user":{"id":"1"}}`, true},
+		{"userservice.Contact", `{"email":"ada@example.com","phoneNumber":"555"}`, false},
+		{"userservice.Contact", `{"phoneNumber":"555","phone_number":"555"}`, false},
+		{"userservice.Contact", `{"user":{"role":"ADMIN"}}`, false},
+		{"google.protobuf.Empty", `{}`, true},
+		{"google.protobuf.Empty", `{"x":1}`, false},
+	}
+
+	for _, tt := range tests {
+		root := schemaFor(t, reg, tt.message)
+
+		var payload interface{}
+		if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+			t.Fatal(err)
+		}
+
+		err := validateJSONSchema(root, root, payload)
+		if tt.valid && err != nil {
+			t.Errorf("%s %s: %v", tt.message, tt.payload, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s %s: accepted, want rejected", tt.message, tt.payload)
+		}
+	}
+}
+
+// validateJSONSchema checks v against the subset of draft 2020-12 that
+// messageJSONSchema produces. Annotations (format, description,
+// contentEncoding) are not asserted.
+func validateJSONSchema(root, schema map[string]interface{}, v interface{}) error {
+	if _, ok := schema["$ref"]; ok {
+		return validateJSONSchema(root, def(schema, root), v)
+	}
+
+	if types, ok := schema["type"]; ok && !matchesType(types, v) {
+		return fmt.Errorf("%v is not of type %v", v, types)
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		if s, isString := v.(string); isString && !regexp.MustCompile(pattern).MatchString(s) {
+			return fmt.Errorf("%q does not match %s", s, pattern)
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !slices.Contains(enum, v) {
+		return fmt.Errorf("%v is not one of %v", v, enum)
+	}
+
+	if n, isNumber := v.(float64); isNumber {
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			return fmt.Errorf("%v is below %v", n, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && n > max {
+			return fmt.Errorf("%v is above %v", n, max)
+		}
+	}
+
+	if err := validateObject(root, schema, v); err != nil {
+		return err
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		list, _ := v.([]interface{})
+		for _, item := range list {
+			if err := validateJSONSchema(root, items, item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return validateCombinators(root, schema, v)
+}
+
+func validateObject(root, schema map[string]interface{}, v interface{}) error {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, present := obj[name.(string)]; !present {
+				return fmt.Errorf("missing %v", name)
+			}
+		}
+	}
+
+	dependent, _ := schema["dependentSchemas"].(map[string]interface{})
+	for name, sub := range dependent {
+		if _, present := obj[name]; present {
+			if err := validateJSONSchema(root, sub.(map[string]interface{}), obj); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for name, value := range obj {
+		if names, ok := schema["propertyNames"].(map[string]interface{}); ok {
+			if err := validateJSONSchema(root, names, name); err != nil {
+				return err
+			}
+		}
+
+		if prop, ok := properties[name].(map[string]interface{}); ok {
+			if err := validateJSONSchema(root, prop, value); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			continue
+		}
+
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				return fmt.Errorf("unknown property %s", name)
+			}
+		case map[string]interface{}:
+			if err := validateJSONSchema(root, extra, value); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateCombinators(root, schema map[string]interface{}, v interface{}) error {
+	count := func(key string) (int, int) {
+		subs, _ := schema[key].([]interface{})
+		matched := 0
+		for _, sub := range subs {
+			if validateJSONSchema(root, sub.(map[string]interface{}), v) == nil {
+				matched++
+			}
+		}
+		return matched, len(subs)
+	}
+
+	if matched, total := count("allOf"); matched != total {
+		return fmt.Errorf("allOf: %d of %d match", matched, total)
+	}
+	if matched, total := count("anyOf"); total > 0 && matched == 0 {
+		return fmt.Errorf("anyOf: none of %d match", total)
+	}
+	if matched, total := count("oneOf"); total > 0 && matched != 1 {
+		return fmt.Errorf("oneOf: %d of %d match", matched, total)
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && validateJSONSchema(root, not, v) == nil {
+		return fmt.Errorf("matches not")
+	}
+	return nil
+}
+
+func matchesType(types interface{}, v interface{}) bool {
+	list, ok := types.([]interface{})
+	if !ok {
+		list = []interface{}{types}
+	}
+
+	for _, typ := range list {
+		switch typ {
+		case "object":
+			_, ok = v.(map[string]interface{})
+		case "array":
+			_, ok = v.([]interface{})
+		case "string":
+			_, ok = v.(string)
+		case "boolean":
+			_, ok = v.(bool)
+		case "null":
+			ok = v == nil
+		case "number":
+			_, ok = v.(float64)
+		case "integer":
+			n, isNumber := v.(float64)
+			ok = isNumber && n == math.Trunc(n)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
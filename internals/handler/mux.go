@@ -0,0 +1,370 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Multiplexed protocol configuration
+const (
+	MuxVersion          = 2
+	MuxInboundQueueSize = MaxQueuedMessages // the call's pump drains it into its own queue
+)
+
+type EnvelopeType string
+
+// Envelope types. start, message, half-close, cancel and grant are sent by
+// the client; headers, message, trailers, status and error by the server.
+const (
+	EnvelopeStart     EnvelopeType = "start"
+	EnvelopeMessage   EnvelopeType = "message"
+	EnvelopeHalfClose EnvelopeType = "half-close"
+	EnvelopeCancel    EnvelopeType = "cancel"
+	EnvelopeGrant     EnvelopeType = "grant"
+	EnvelopeHeaders   EnvelopeType = "headers"
+	EnvelopeTrailers  EnvelopeType = "trailers"
+	EnvelopeStatus    EnvelopeType = "status"
+	EnvelopeError     EnvelopeType = "error"
+)
+
+// Log messages as variables
+var (
+	MsgInvalidEnvelope     = "Invalid envelope"
+	MsgUnsupportedVersion  = "Unsupported protocol version"
+	MsgMissingCallID       = "Envelope has no call id"
+	MsgMissingStartInit    = "Start envelope has no init"
+	MsgDuplicateCallID     = "Call id already in use"
+	MsgUnknownCallID       = "Unknown call id"
+	MsgUnknownEnvelopeType = "Unknown envelope type"
+	MsgCallQueueFull       = "Too many messages waiting for the call; message dropped"
+)
+
+// Envelope is one client-to-server frame of the multiplexed protocol.
+type Envelope struct {
+	V       int             `json:"v"`
+	ID      string          `json:"id"`
+	Type    EnvelopeType    `json:"type"`
+	Init    *InitMessage    `json:"init,omitempty"`    // start
+	Message json.RawMessage `json:"message,omitempty"` // message
+	Credits int             `json:"credits,omitempty"` // grant
+}
+
+// EnvelopeFrame is a Frame addressed to one call of a multiplexed
+// connection. Its type shadows the frame's own.
+type EnvelopeFrame struct {
+	V    int          `json:"v"`
+	ID   string       `json:"id,omitempty"`
+	Type EnvelopeType `json:"type"`
+	*Frame
+}
+
+var envelopeTypes = map[FrameType]EnvelopeType{
+	FrameHeader:  EnvelopeHeaders,
+	FrameMessage: EnvelopeMessage,
+	FrameTrailer: EnvelopeTrailers,
+	FrameStatus:  EnvelopeStatus,
+	FrameError:   EnvelopeError,
+}
+
+// muxSession runs every call started on one connection. Each call gets a
+// muxCallConn, so the call protocol itself is the same as for a dedicated
+// connection.
+type muxSession struct {
+	conn        streamConn
+	workspaceID string
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	calls   map[string]*muxCallConn
+	running sync.WaitGroup
+}
+
+// isMuxEnvelope reports whether the first message on a connection opens
+// the multiplexed protocol, i.e. carries a protocol version.
+func isMuxEnvelope(msgRaw []byte) bool {
+	var probe struct {
+		V *int `json:"v"`
+	}
+	return json.Unmarshal(msgRaw, &probe) == nil && probe.V != nil
+}
+
+// serveMux runs the multiplexed protocol over conn, starting with the
+// already-read first envelope, until the connection closes. Calls still
+// running then are cancelled and waited for.
+func serveMux(conn streamConn, first []byte, workspaceID string) {
+	mux := &muxSession{
+		conn:        conn,
+		workspaceID: workspaceID,
+		calls:       make(map[string]*muxCallConn),
+	}
+	defer mux.running.Wait()
+	defer mux.closeAll()
+
+	msgRaw := first
+	for {
+		mux.dispatch(msgRaw)
+
+		var err error
+		if _, msgRaw, err = conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (m *muxSession) dispatch(msgRaw []byte) {
+	var env Envelope
+	if err := json.Unmarshal(msgRaw, &env); err != nil {
+		m.sendError("", MsgInvalidEnvelope, err.Error())
+		return
+	}
+
+	if env.V != MuxVersion {
+		m.sendError(env.ID, MsgUnsupportedVersion, "")
+		return
+	}
+
+	if env.ID == "" {
+		m.sendError("", MsgMissingCallID, "")
+		return
+	}
+
+	switch env.Type {
+	case EnvelopeStart:
+		m.start(&env)
+	case EnvelopeMessage:
+		m.deliver(env.ID, env.Message)
+	case EnvelopeHalfClose:
+		m.halfClose(env.ID)
+	case EnvelopeCancel:
+		m.cancel(env.ID)
+	case EnvelopeGrant:
+		m.grant(env.ID, env.Credits)
+	default:
+		m.sendError(env.ID, MsgUnknownEnvelopeType, string(env.Type))
+	}
+}
+
+func (m *muxSession) start(env *Envelope) {
+	if env.Init == nil {
+		m.sendError(env.ID, MsgMissingStartInit, "")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.calls[env.ID]; exists {
+		m.sendError(env.ID, MsgDuplicateCallID, "")
+		return
+	}
+
+	conn := newMuxCallConn(m, env.ID, env.Init.JSON.indent())
+	m.calls[env.ID] = conn
+	m.running.Add(1)
+
+	go func() {
+		defer m.running.Done()
+		defer m.finish(conn)
+
+		runCall(conn, env.Init, m.workspaceID)
+	}()
+}
+
+// deliver queues msgRaw for the call's read pump. The connection's reader
+// never waits on a call: past MuxInboundQueueSize the message is dropped
+// with an error frame, so a stalled call cannot hold up the others. Control
+// frames sent as messages are queued regardless, like their envelopes.
+func (m *muxSession) deliver(id string, msgRaw []byte) {
+	conn, ok := m.lookup(id)
+	if !ok {
+		return
+	}
+
+	_, isControl := parseControlFrame(msgRaw)
+	if !conn.push(msgRaw, isControl) {
+		m.sendError(id, MsgCallQueueFull, "")
+	}
+}
+
+// halfClose ends the call's input after the messages already queued. It is
+// queued past the limit, as dropping it would leave the call waiting.
+func (m *muxSession) halfClose(id string) {
+	if conn, ok := m.lookup(id); ok {
+		conn.push(controlMessage(&ControlFrame{Control: ControlHalfClose}), true)
+	}
+}
+
+// grant adds flow control credits to the call. Like halfClose it is queued
+// past the limit, so a full queue never keeps a call from getting credits.
+func (m *muxSession) grant(id string, credits int) {
+	if conn, ok := m.lookup(id); ok {
+		conn.push(controlMessage(&ControlFrame{Control: ControlGrant, Credits: credits}), true)
+	}
+}
+
+// cancel closes the call's connection, which cancels the call as soon as
+// its read pump sees it, ahead of any queued messages.
+func (m *muxSession) cancel(id string) {
+	if conn, ok := m.lookup(id); ok {
+		conn.close()
+	}
+}
+
+func (m *muxSession) lookup(id string) (*muxCallConn, bool) {
+	m.mu.Lock()
+	conn, ok := m.calls[id]
+	m.mu.Unlock()
+	if !ok {
+		m.sendError(id, MsgUnknownCallID, "")
+	}
+	return conn, ok
+}
+
+// finish frees the call's ID and closes its connection. It runs before the
+// status frame is written, so the ID is free by the time the client sees
+// it, and again when the call returns.
+func (m *muxSession) finish(conn *muxCallConn) {
+	m.mu.Lock()
+	if m.calls[conn.id] == conn {
+		delete(m.calls, conn.id)
+	}
+	m.mu.Unlock()
+
+	conn.close()
+}
+
+func (m *muxSession) closeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, conn := range m.calls {
+		conn.close()
+	}
+}
+
+func (m *muxSession) send(id string, frame *Frame, indent string) error {
+	data, err := marshalFrame(&EnvelopeFrame{V: MuxVersion, ID: id, Type: envelopeTypes[frame.Type], Frame: frame}, indent)
+	if err != nil {
+		return err
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	return m.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (m *muxSession) sendError(id, msg, details string) error {
+	return m.send(id, &Frame{Type: FrameError, Error: msg, Details: details}, "")
+}
+
+func controlMessage(ctl *ControlFrame) []byte {
+	data, _ := json.Marshal(ctl)
+	return data
+}
+
+// muxCallConn is the streamConn of one multiplexed call. Reads return the
+// messages the session routes to the call; writes are wrapped in envelopes
+// carrying the call ID, indented like the call's frames.
+type muxCallConn struct {
+	mux    *muxSession
+	id     string
+	indent string
+
+	mu        sync.Mutex
+	pending   [][]byte
+	ready     chan struct{} // signalled when pending grows
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMuxCallConn(mux *muxSession, id, indent string) *muxCallConn {
+	return &muxCallConn{
+		mux:    mux,
+		id:     id,
+		indent: indent,
+		ready:  make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+}
+
+// push queues msgRaw without blocking and reports whether it fit; force
+// queues it regardless of MuxInboundQueueSize.
+func (c *muxCallConn) push(msgRaw []byte, force bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !force && len(c.pending) >= MuxInboundQueueSize {
+		return false
+	}
+	c.pending = append(c.pending, msgRaw)
+
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (c *muxCallConn) close() {
+	c.closeOnce.Do(func() { close(c.closed) })
+}
+
+// ReadMessage returns the next queued message. Once the call is closed it
+// fails straight away, even with messages still queued.
+func (c *muxCallConn) ReadMessage() (int, []byte, error) {
+	for {
+		select {
+		case <-c.closed:
+			return 0, nil, io.EOF
+		default:
+		}
+
+		c.mu.Lock()
+		if len(c.pending) > 0 {
+			msgRaw := c.pending[0]
+			c.pending[0] = nil
+			c.pending = c.pending[1:]
+			c.mu.Unlock()
+			return websocket.TextMessage, msgRaw, nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.ready:
+		case <-c.closed:
+			return 0, nil, io.EOF
+		}
+	}
+}
+
+// WriteMessage writes an already encoded frame.
+func (c *muxCallConn) WriteMessage(_ int, data []byte) error {
+	var frame Frame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return err
+	}
+	return c.writeFrame(&frame)
+}
+
+func (c *muxCallConn) WriteJSON(v interface{}) error {
+	if frame, ok := v.(*Frame); ok {
+		return c.writeFrame(frame)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *muxCallConn) writeFrame(frame *Frame) error {
+	if frame.Type == FrameStatus {
+		c.mux.finish(c)
+	}
+	return c.mux.send(c.id, frame, c.indent)
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+)
+
+// muxReply is a server envelope as the client sees it.
+type muxReply struct {
+	ID     string       `json:"id"`
+	Type   EnvelopeType `json:"type"`
+	Error  string       `json:"error"`
+	Status *RPCStatus   `json:"status"`
+}
+
+func sendEnvelope(t *testing.T, conn *websocket.Conn, env *Envelope) {
+	t.Helper()
+
+	env.V = MuxVersion
+	if err := conn.WriteJSON(env); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// awaitStatus reads envelopes until the status of call id, failing on any
+// error envelope.
+func awaitStatus(t *testing.T, conn *websocket.Conn, id string) *RPCStatus {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		var reply muxReply
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("waiting for status of %s: %v", id, err)
+		}
+		if reply.Type == EnvelopeError {
+			t.Fatalf("error envelope for %q: %s", reply.ID, reply.Error)
+		}
+		if reply.ID == id && reply.Type == EnvelopeStatus {
+			return reply.Status
+		}
+	}
+}
+
+func TestMuxStalledCallDoesNotBlockOthers(t *testing.T) {
+	target, started, done := startSinkServer(t)
+	sink := newSinkWorkspace(t)
+	health := newHealthWorkspace(t)
+	healthTarget := startHealthServer(t)
+	conn := dialCallSocket(t)
+
+	sendEnvelope(t, conn, &Envelope{ID: "upload", Type: EnvelopeStart, Init: &InitMessage{
+		Workspace: sink.ID,
+		Target:    target,
+		Service:   "sink.Sink",
+		Method:    "Upload",
+		Mode:      string(ModeClient),
+	}})
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("backend call did not start")
+	}
+
+	chunk, _ := json.Marshal(map[string][]byte{"data": make([]byte, 15<<10)})
+	for i := 0; i < 100; i++ {
+		sendEnvelope(t, conn, &Envelope{ID: "upload", Type: EnvelopeMessage, Message: chunk})
+	}
+
+	// The same ID is started twice in a row: it must be free once the
+	// first status has arrived.
+	for i := 0; i < 2; i++ {
+		sendEnvelope(t, conn, &Envelope{ID: "check", Type: EnvelopeStart, Init: &InitMessage{
+			Workspace: health.ID,
+			Target:    healthTarget,
+			Service:   "grpc.health.v1.Health",
+			Method:    "Check",
+		}})
+		sendEnvelope(t, conn, &Envelope{ID: "check", Type: EnvelopeMessage, Message: json.RawMessage(`{"service":"svc"}`)})
+
+		if st := awaitStatus(t, conn, "check"); st.Code != codes.OK {
+			t.Fatalf("check %d: status %v", i, st.Code)
+		}
+	}
+
+	sendEnvelope(t, conn, &Envelope{ID: "upload", Type: EnvelopeCancel})
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("backend call was not cancelled")
+	}
+	if st := awaitStatus(t, conn, "upload"); st.Code != codes.Canceled {
+		t.Fatalf("upload: status %v, want %v", st.Code, codes.Canceled)
+	}
+}
+
+// A flow-controlled call holds back its messages until credits arrive, as a
+// grant envelope or as a control frame in a message envelope.
+func TestMuxGrant(t *testing.T) {
+	target := startEchoServer(t)
+	ws := newProtoWorkspace(t, "echo.proto", echoProto)
+	conn := dialCallSocket(t)
+
+	for name, grant := range map[string]*Envelope{
+		"grant envelope":   {Type: EnvelopeGrant, Credits: 2},
+		"message envelope": {Type: EnvelopeMessage, Message: json.RawMessage(`{"@control":"grant","credits":2}`)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sendEnvelope(t, conn, &Envelope{ID: "chat", Type: EnvelopeStart, Init: &InitMessage{
+				Workspace: ws.ID,
+				Target:    target,
+				Service:   "echo.Echo",
+				Method:    "Chat",
+				Flow:      &FlowConfig{Credits: 1},
+			}})
+			for _, msg := range []string{`"a"`, `"b"`, `"c"`} {
+				sendEnvelope(t, conn, &Envelope{ID: "chat", Type: EnvelopeMessage, Message: json.RawMessage(msg)})
+			}
+			sendEnvelope(t, conn, &Envelope{ID: "chat", Type: EnvelopeHalfClose})
+
+			// The initial credit covers one echo; the other two and the
+			// status wait for the grant.
+			messages := 0
+			conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+			for {
+				var reply muxReply
+				if err := conn.ReadJSON(&reply); err != nil {
+					t.Fatalf("after %d messages: %v", messages, err)
+				}
+				switch reply.Type {
+				case EnvelopeMessage:
+					if messages++; messages == 1 {
+						grant.ID = "chat"
+						sendEnvelope(t, conn, grant)
+					}
+				case EnvelopeError:
+					t.Fatalf("error envelope: %s", reply.Error)
+				case EnvelopeStatus:
+					if messages != 3 || reply.Status.Code != codes.OK {
+						t.Fatalf("status %v after %d messages", reply.Status.Code, messages)
+					}
+					return
+				}
+			}
+		})
+	}
+}
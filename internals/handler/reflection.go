@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const DefaultReflectionTimeout = 30 * time.Second
+
+// Log messages as variables
+var (
+	MsgReflectionLoaded       = "Descriptors loaded via server reflection"
+	MsgInvalidReflectionJSON  = "Invalid reflection request JSON"
+	MsgMissingTarget          = "Target is required"
+	MsgListServicesFailed     = "Reflection ListServices failed"
+	MsgResolveServiceFailed   = "Reflection failed to resolve service %s"
+	MsgNoServicesReflected    = "Server reflection returned no services"
+	MsgReflectionNotSupported = "Target does not support server reflection"
+)
+
+// ReflectionRequest describes the target whose descriptors should be loaded
+// through the gRPC server reflection service.
+type ReflectionRequest struct {
+	Target   string            `json:"target"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Auth     *AuthConfig       `json:"auth,omitempty"`
+	TLS      *TLSConfig        `json:"tls,omitempty"`
+	LBPolicy string            `json:"loadBalancing,omitempty"`
+}
+
+// Reflection load handler
+func HandleReflectionLoad(c *gin.Context) {
+	var req ReflectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidReflectionJSON})
+		return
+	}
+
+	if req.Target == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgMissingTarget})
+		return
+	}
+
+	ws, err := resolveOrCreateWorkspace(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgWorkspaceNotFound})
+		return
+	}
+
+	pooled, err := acquireConn(req.Target, req.TLS, req.LBPolicy)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": MsgDialTargetFailed, "details": err.Error()})
+		return
+	}
+	defer pooled.release()
+
+	ctx := buildContext(&InitMessage{Target: req.Target, Metadata: req.Metadata, Auth: req.Auth})
+	ctx, cancel := context.WithTimeout(ctx, DefaultReflectionTimeout)
+	defer cancel()
+
+	fds, services, err := reflectDescriptorSet(ctx, grpcreflect.NewClientAuto(ctx, pooled.cc))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ws.setDescriptorSet(fds); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": MsgReflectionLoaded, "workspaceId": ws.ID, "services": services})
+}
+
+// reflectDescriptorSet resolves every service exposed by the reflection
+// client and returns the files defining them together with all of their
+// transitive dependencies, topologically sorted like protoc --include_imports.
+func reflectDescriptorSet(ctx context.Context, client *grpcreflect.Client) (*descriptorpb.FileDescriptorSet, []string, error) {
+	defer client.Reset()
+
+	services, err := client.ListServices()
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil, nil, errors.New(MsgReflectionNotSupported)
+		}
+		return nil, nil, fmt.Errorf("%s: %v", MsgListServicesFailed, err)
+	}
+
+	if len(services) == 0 {
+		return nil, nil, errors.New(MsgNoServicesReflected)
+	}
+
+	files := make([]*desc.FileDescriptor, 0, len(services))
+	for _, name := range services {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		sd, err := client.ResolveService(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf(MsgResolveServiceFailed+": %v", name, err)
+		}
+		files = append(files, sd.GetFile())
+	}
+
+	return desc.ToFileDescriptorSet(files...), services, nil
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// descriptorRegistry is a fully linked view of a loaded descriptor set. It is
+// built once when the set is loaded so that types imported from other files
+// (google.protobuf.Empty, Timestamp, ...) resolve on every lookup.
+type descriptorRegistry struct {
+	files    []*desc.FileDescriptor
+	services map[string]*desc.ServiceDescriptor // keyed by fully-qualified name
+	types    *typeResolver
+}
+
+func newDescriptorRegistry(fds *descriptorpb.FileDescriptorSet) (*descriptorRegistry, error) {
+	linked, err := desc.CreateFileDescriptorsFromSet(fds)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := &descriptorRegistry{
+		files:    make([]*desc.FileDescriptor, 0, len(fds.GetFile())),
+		services: make(map[string]*desc.ServiceDescriptor),
+	}
+
+	// Keep the set's order (dependencies first) for deterministic listings.
+	for _, fdp := range fds.GetFile() {
+		fd := linked[fdp.GetName()]
+		reg.files = append(reg.files, fd)
+
+		for _, sd := range fd.GetServices() {
+			reg.services[sd.GetFullyQualifiedName()] = sd
+		}
+	}
+	reg.types = &typeResolver{registry: reg}
+
+	return reg, nil
+}
+
+// resolver returns the registry's type resolver; a nil registry resolves
+// the types linked into the binary only.
+func (r *descriptorRegistry) resolver() *typeResolver {
+	if r == nil {
+		return &typeResolver{}
+	}
+	return r.types
+}
+
+// findMethod resolves a method on a service named by fully-qualified or
+// simple name; every service sharing a simple name is tried in turn.
+func (r *descriptorRegistry) findMethod(service, method string) *desc.MethodDescriptor {
+	if sd, ok := r.services[service]; ok {
+		if md := sd.FindMethodByName(method); md != nil {
+			return md
+		}
+	}
+
+	for _, fd := range r.files {
+		for _, sd := range fd.GetServices() {
+			if sd.GetName() != service {
+				continue
+			}
+			if md := sd.FindMethodByName(method); md != nil {
+				return md
+			}
+		}
+	}
+	return nil
+}
+
+// findMessage resolves a message type by fully-qualified name.
+func (r *descriptorRegistry) findMessage(name string) *desc.MessageDescriptor {
+	for _, fd := range r.files {
+		if md := fd.FindMessage(name); md != nil {
+			return md
+		}
+	}
+	return nil
+}
+
+// typeResolver resolves the types named by google.protobuf.Any values:
+// every loaded file first, then the types linked into the binary
+// (well-known types, errdetails). A message's own imports alone would miss
+// types that are only ever packed into an Any. It serves payloads (jsonpb)
+// and status details (protojson) alike, so both agree on every name.
+type typeResolver struct {
+	registry *descriptorRegistry
+}
+
+// Resolve implements jsonpb.AnyResolver.
+func (r *typeResolver) Resolve(typeURL string) (proto.Message, error) {
+	name := typeNameFromURL(typeURL)
+	if md := r.findMessage(name); md != nil {
+		return dynamic.NewMessage(md), nil
+	}
+
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type %q", name)
+	}
+	return proto.MessageV1(mt.New().Interface()), nil
+}
+
+func (r *typeResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if md := r.findMessage(string(name)); md != nil {
+		return dynamicpb.NewMessageType(md.UnwrapMessage()), nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(name)
+}
+
+func (r *typeResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	return r.FindMessageByName(protoreflect.FullName(typeNameFromURL(url)))
+}
+
+func (r *typeResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (r *typeResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+// findDescriptor looks name up in the same order as Resolve, returning a
+// descriptor whichever way it is found.
+func (r *typeResolver) findDescriptor(name string) *desc.MessageDescriptor {
+	if md := r.findMessage(name); md != nil {
+		return md
+	}
+
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil
+	}
+	md, err := desc.WrapMessage(mt.Descriptor())
+	if err != nil {
+		return nil
+	}
+	return md
+}
+
+func (r *typeResolver) findMessage(name string) *desc.MessageDescriptor {
+	if r.registry == nil {
+		return nil
+	}
+	return r.registry.findMessage(name)
+}
+
+// typeNameFromURL returns the message name at the end of an Any type URL.
+func typeNameFromURL(url string) string {
+	if i := strings.LastIndexByte(url, '/'); i >= 0 {
+		return url[i+1:]
+	}
+	return url
+}
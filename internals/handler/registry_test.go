@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestTypeResolver(t *testing.T) {
+	reg := compileExampleRegistry(t)
+	resolver := reg.resolver()
+
+	// Workspace types come from the descriptors for payloads and status
+	// details alike, ahead of anything linked in.
+	for _, name := range []string{"userservice.User", "google.protobuf.Timestamp"} {
+		msg, err := resolver.Resolve("type.googleapis.com/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := msg.(*dynamic.Message); !ok {
+			t.Errorf("payload %s resolved to %T, want a workspace type", name, msg)
+		}
+
+		mt, err := resolver.FindMessageByURL("type.googleapis.com/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := mt.New().Interface(); !isDynamicMessage(msg) {
+			t.Errorf("status detail %s resolved to %T, want a workspace type", name, msg)
+		}
+	}
+
+	// Linked-in types resolve without any workspace.
+	detail, err := anypb.New(durationpb.New(1500000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal(decodeStatusDetail(detail, (*descriptorRegistry)(nil).resolver()), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["value"] != "1.500s" {
+		t.Fatalf("duration detail: %v", decoded)
+	}
+
+	if _, err := resolver.Resolve("type.googleapis.com/no.such.Type"); err == nil {
+		t.Fatal("unknown type resolved")
+	}
+}
+
+func isDynamicMessage(msg interface{}) bool {
+	_, ok := msg.(*dynamicpb.Message)
+	return ok
+}
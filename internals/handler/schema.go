@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Schema is the structure of one or more methods. Messages and enums are
+// listed once each, keyed by full name, and fields refer to them by that
+// name, so nested and recursive types need no special casing.
+type Schema struct {
+	Services []ServiceSchema          `json:"services,omitempty"`
+	Method   *MethodSchema            `json:"method,omitempty"`
+	Messages map[string]MessageSchema `json:"messages"`
+	Enums    map[string]EnumSchema    `json:"enums"`
+}
+
+type ServiceSchema struct {
+	Name     string         `json:"name"`
+	FullName string         `json:"fullName"`
+	Comments string         `json:"comments,omitempty"`
+	Methods  []MethodSchema `json:"methods"`
+}
+
+type MethodSchema struct {
+	Name            string `json:"name"`
+	FullName        string `json:"fullName"`
+	Service         string `json:"service"`
+	ClientStreaming bool   `json:"clientStreaming"`
+	ServerStreaming bool   `json:"serverStreaming"`
+	Mode            string `json:"mode"`
+	InputType       string `json:"inputType"`
+	OutputType      string `json:"outputType"`
+	Comments        string `json:"comments,omitempty"`
+}
+
+type MessageSchema struct {
+	FullName string        `json:"fullName"`
+	Comments string        `json:"comments,omitempty"`
+	Fields   []FieldSchema `json:"fields"`
+	Oneofs   []OneofSchema `json:"oneofs,omitempty"`
+}
+
+// FieldSchema describes one field. Type is the proto scalar type, "message"
+// or "enum"; TypeName then names the message or enum.
+type FieldSchema struct {
+	Name     string     `json:"name"`
+	JSONName string     `json:"jsonName"`
+	Number   int32      `json:"number"`
+	Type     string     `json:"type"`
+	TypeName string     `json:"typeName,omitempty"`
+	Label    string     `json:"label"` // optional, required or repeated
+	Optional bool       `json:"optional,omitempty"`
+	Oneof    string     `json:"oneof,omitempty"`
+	Map      *MapSchema `json:"map,omitempty"`
+	Comments string     `json:"comments,omitempty"`
+}
+
+type MapSchema struct {
+	KeyType       string `json:"keyType"`
+	ValueType     string `json:"valueType"`
+	ValueTypeName string `json:"valueTypeName,omitempty"`
+}
+
+type OneofSchema struct {
+	Name     string   `json:"name"`
+	Fields   []string `json:"fields"`
+	Comments string   `json:"comments,omitempty"`
+}
+
+type EnumSchema struct {
+	FullName string            `json:"fullName"`
+	Comments string            `json:"comments,omitempty"`
+	Values   []EnumValueSchema `json:"values"`
+}
+
+type EnumValueSchema struct {
+	Name     string `json:"name"`
+	Number   int32  `json:"number"`
+	Comments string `json:"comments,omitempty"`
+}
+
+// Schema handler: every service and method in the workspace
+func HandleSchema(c *gin.Context) {
+	reg := registryFromRequest(c)
+	if reg == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoDescriptorLoaded})
+		return
+	}
+
+	schema := newSchema()
+	for _, file := range reg.files {
+		for _, sd := range file.GetServices() {
+			schema.Services = append(schema.Services, schema.addService(sd))
+		}
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+// Method schema handler
+func HandleMethodSchema(c *gin.Context) {
+	reg := registryFromRequest(c)
+	if reg == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNoDescriptorLoaded})
+		return
+	}
+
+	md := reg.findMethod(c.Param("service"), c.Param("method"))
+	if md == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgMethodNotFound})
+		return
+	}
+
+	schema := newSchema()
+	method := schema.addMethod(md)
+	schema.Method = &method
+
+	c.JSON(http.StatusOK, schema)
+}
+
+func registryFromRequest(c *gin.Context) *descriptorRegistry {
+	ws, err := resolveWorkspace(c)
+	if err != nil {
+		return nil
+	}
+	return ws.currentRegistry()
+}
+
+func newSchema() *Schema {
+	return &Schema{
+		Messages: make(map[string]MessageSchema),
+		Enums:    make(map[string]EnumSchema),
+	}
+}
+
+func (s *Schema) addService(sd *desc.ServiceDescriptor) ServiceSchema {
+	service := ServiceSchema{
+		Name:     sd.GetName(),
+		FullName: sd.GetFullyQualifiedName(),
+		Comments: leadingComments(sd),
+		Methods:  make([]MethodSchema, 0, len(sd.GetMethods())),
+	}
+
+	for _, md := range sd.GetMethods() {
+		service.Methods = append(service.Methods, s.addMethod(md))
+	}
+	return service
+}
+
+func (s *Schema) addMethod(md *desc.MethodDescriptor) MethodSchema {
+	s.addMessage(md.GetInputType())
+	s.addMessage(md.GetOutputType())
+
+	return MethodSchema{
+		Name:            md.GetName(),
+		FullName:        md.GetFullyQualifiedName(),
+		Service:         md.GetService().GetFullyQualifiedName(),
+		ClientStreaming: md.IsClientStreaming(),
+		ServerStreaming: md.IsServerStreaming(),
+		Mode:            string(inferMode(md)),
+		InputType:       md.GetInputType().GetFullyQualifiedName(),
+		OutputType:      md.GetOutputType().GetFullyQualifiedName(),
+		Comments:        leadingComments(md),
+	}
+}
+
+// addMessage records md and every type reachable from its fields. A type is
+// recorded before its fields are walked, which ends recursion.
+func (s *Schema) addMessage(md *desc.MessageDescriptor) {
+	name := md.GetFullyQualifiedName()
+	if _, seen := s.Messages[name]; seen {
+		return
+	}
+	s.Messages[name] = MessageSchema{FullName: name}
+
+	msg := MessageSchema{
+		FullName: name,
+		Comments: leadingComments(md),
+		Fields:   make([]FieldSchema, 0, len(md.GetFields())),
+	}
+
+	for _, fd := range md.GetFields() {
+		msg.Fields = append(msg.Fields, s.addField(fd))
+	}
+
+	for _, od := range md.GetOneOfs() {
+		if od.IsSynthetic() {
+			continue // proto3 optional
+		}
+
+		oneof := OneofSchema{Name: od.GetName(), Comments: leadingComments(od)}
+		for _, choice := range od.GetChoices() {
+			oneof.Fields = append(oneof.Fields, choice.GetName())
+		}
+		msg.Oneofs = append(msg.Oneofs, oneof)
+	}
+
+	s.Messages[name] = msg
+}
+
+func (s *Schema) addField(fd *desc.FieldDescriptor) FieldSchema {
+	field := FieldSchema{
+		Name:     fd.GetName(),
+		JSONName: fd.GetJSONName(),
+		Number:   fd.GetNumber(),
+		Label:    strings.ToLower(strings.TrimPrefix(fd.GetLabel().String(), "LABEL_")),
+		Optional: fd.IsProto3Optional(),
+		Comments: leadingComments(fd),
+	}
+
+	if od := fd.GetOneOf(); od != nil && !od.IsSynthetic() {
+		field.Oneof = od.GetName()
+	}
+
+	if fd.IsMap() {
+		key, value := fd.GetMapKeyType(), fd.GetMapValueType()
+		field.Type = "map"
+		field.Map = &MapSchema{
+			KeyType:       fieldTypeName(key.GetType()),
+			ValueType:     fieldTypeName(value.GetType()),
+			ValueTypeName: s.addFieldType(value),
+		}
+		return field
+	}
+
+	field.Type = fieldTypeName(fd.GetType())
+	field.TypeName = s.addFieldType(fd)
+	return field
+}
+
+// addFieldType records the message or enum type of fd, if any, and returns
+// its full name.
+func (s *Schema) addFieldType(fd *desc.FieldDescriptor) string {
+	if mt := fd.GetMessageType(); mt != nil {
+		s.addMessage(mt)
+		return mt.GetFullyQualifiedName()
+	}
+
+	if et := fd.GetEnumType(); et != nil {
+		s.addEnum(et)
+		return et.GetFullyQualifiedName()
+	}
+
+	return ""
+}
+
+func (s *Schema) addEnum(ed *desc.EnumDescriptor) {
+	name := ed.GetFullyQualifiedName()
+	if _, seen := s.Enums[name]; seen {
+		return
+	}
+
+	enum := EnumSchema{
+		FullName: name,
+		Comments: leadingComments(ed),
+		Values:   make([]EnumValueSchema, 0, len(ed.GetValues())),
+	}
+
+	for _, vd := range ed.GetValues() {
+		enum.Values = append(enum.Values, EnumValueSchema{
+			Name:     vd.GetName(),
+			Number:   vd.GetNumber(),
+			Comments: leadingComments(vd),
+		})
+	}
+
+	s.Enums[name] = enum
+}
+
+// fieldTypeName turns TYPE_INT32 into int32, TYPE_MESSAGE into message, ...
+// Groups are reported as messages.
+func fieldTypeName(t descriptorpb.FieldDescriptorProto_Type) string {
+	if t == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		return "message"
+	}
+	return strings.ToLower(strings.TrimPrefix(t.String(), "TYPE_"))
+}
+
+// leadingComments returns the comment block above d, when the descriptors
+// carry source info (compiled uploads do; reflection usually does not).
+func leadingComments(d desc.Descriptor) string {
+	return strings.TrimSpace(d.GetSourceInfo().GetLeadingComments())
+}
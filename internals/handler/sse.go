@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Log messages as variables
+var (
+	MsgInvalidStreamJSON     = "Invalid stream request JSON"
+	MsgInvalidStreamQuery    = "Invalid stream query parameter"
+	MsgNotServerStreamMethod = "Method is not server streaming; use the WebSocket stream"
+)
+
+// SSE stream handler. Runs a server-streaming method and emits each frame
+// as an event named after its type: header, message, trailer, status or
+// error. POST takes an invoke request body; GET (for EventSource) takes the
+// same fields as query parameters, see bindStreamQuery. The call is
+// cancelled when the client disconnects.
+func HandleSSEStream(c *gin.Context) {
+	var req InvokeRequest
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidStreamJSON, "details": err.Error()})
+			return
+		}
+	} else if err := bindStreamQuery(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidStreamQuery, "details": err.Error()})
+		return
+	}
+
+	req.Service = c.Param("service")
+	req.Method = c.Param("method")
+	req.Mode = string(ModeServer)
+	if req.Workspace == "" {
+		req.Workspace = workspaceIDFromRequest(c)
+	}
+	if len(req.Request) == 0 {
+		req.Request = req.InputEncoding.emptyPayload()
+	}
+
+	// Problems found before the stream starts get a plain HTTP error.
+	ws, err := lookupWorkspace(req.Workspace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgWorkspaceNotFound})
+		return
+	}
+
+	methodDesc, err := ws.findMethodDescriptor(&req.InitMessage)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if methodDesc.IsClientStreaming() || !methodDesc.IsServerStreaming() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgNotServerStreamMethod})
+		return
+	}
+
+	// The client has no way to send grants back.
+	req.Flow = nil
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	runCall(newSSEConn(c, req.Request), &req.InitMessage, req.Workspace)
+}
+
+// bindStreamQuery fills req from GET query parameters: target, timeout,
+// loadBalancing, inputEncoding and outputEncoding as plain strings, and
+// request, metadata, auth, tls and json as JSON.
+func bindStreamQuery(c *gin.Context, req *InvokeRequest) error {
+	req.Target = c.Query("target")
+	req.Timeout = c.Query("timeout")
+	req.LBPolicy = c.Query("loadBalancing")
+	req.InputEncoding = PayloadEncoding(c.Query("inputEncoding"))
+	req.OutputEncoding = PayloadEncoding(c.Query("outputEncoding"))
+	req.Request = json.RawMessage(c.Query("request"))
+
+	params := []struct {
+		name string
+		dst  interface{}
+	}{
+		{"metadata", &req.Metadata},
+		{"auth", &req.Auth},
+		{"tls", &req.TLS},
+		{"json", &req.JSON},
+	}
+	for _, p := range params {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(raw), p.dst); err != nil {
+			return fmt.Errorf("%s: %v", p.name, err)
+		}
+	}
+	return nil
+}
+
+// sseConn adapts an SSE response to streamConn. Its only inbound message is
+// the request; after that reads block until the client goes away.
+type sseConn struct {
+	c       *gin.Context
+	request []byte
+	once    sync.Once
+}
+
+func newSSEConn(c *gin.Context, request []byte) *sseConn {
+	return &sseConn{c: c, request: request}
+}
+
+func (s *sseConn) ReadMessage() (int, []byte, error) {
+	var request []byte
+	s.once.Do(func() { request = s.request })
+	if request != nil {
+		return websocket.TextMessage, request, nil
+	}
+
+	<-s.c.Request.Context().Done()
+	return 0, nil, io.EOF
+}
+
+// WriteMessage writes an already encoded frame.
+func (s *sseConn) WriteMessage(_ int, data []byte) error {
+	var frame Frame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return err
+	}
+	return s.WriteJSON(&frame)
+}
+
+func (s *sseConn) WriteJSON(v interface{}) error {
+	if err := s.c.Request.Context().Err(); err != nil {
+		return err
+	}
+
+	event := string(FrameMessage)
+	if frame, ok := v.(*Frame); ok {
+		event = string(frame.Type)
+	}
+
+	s.c.SSEvent(event, v)
+	s.c.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func serveSSE(ws *Workspace, method, path string, query url.Values, body string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/api/stream/:service/:method", HandleSSEStream)
+	router.POST("/api/stream/:service/:method", HandleSSEStream)
+
+	query.Set(WorkspaceQueryParam, ws.ID)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, path+"?"+query.Encode(), strings.NewReader(body)))
+	return rec
+}
+
+func TestSSERejectsNonServerStreamingMethods(t *testing.T) {
+	ws := newHealthWorkspace(t)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		rec := serveSSE(ws, method, "/api/stream/grpc.health.v1.Health/Check", url.Values{}, "{}")
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), MsgNotServerStreamMethod) {
+			t.Errorf("%s: %d %s", method, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestSSEQueryMetadata(t *testing.T) {
+	ws := newHealthWorkspace(t)
+
+	// The interceptor ends Watch straight away, reporting what it was sent.
+	received := make(chan metadata.MD, 1)
+	target := startHealthServer(t, grpc.StreamInterceptor(
+		func(_ interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, _ grpc.StreamHandler) error {
+			md, _ := metadata.FromIncomingContext(ss.Context())
+			received <- md
+			return status.Error(codes.Unavailable, "done")
+		}))
+
+	rec := serveSSE(ws, http.MethodGet, "/api/stream/grpc.health.v1.Health/Watch", url.Values{
+		"target":   {target},
+		"request":  {`{"service":"svc"}`},
+		"metadata": {`{"x-trace":"42"}`},
+	}, "")
+	if !strings.Contains(rec.Body.String(), "event:status") {
+		t.Fatalf("no status event: %s", rec.Body)
+	}
+	if got := (<-received).Get("x-trace"); len(got) != 1 || got[0] != "42" {
+		t.Fatalf("x-trace = %v", got)
+	}
+
+	rec = serveSSE(ws, http.MethodGet, "/api/stream/grpc.health.v1.Health/Watch", url.Values{
+		"target":   {target},
+		"metadata": {`not json`},
+	}, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad metadata: %d %s", rec.Code, rec.Body)
+	}
+}
+
+// SSE has no way to send grants, so a flow config must not hold back the
+// end of the stream.
+func TestSSEIgnoresFlow(t *testing.T) {
+	ws := newHealthWorkspace(t)
+	target := startHealthServer(t, grpc.StreamInterceptor(
+		func(_ interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, _ grpc.StreamHandler) error {
+			for i := 0; i < 5; i++ {
+				if err := ss.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+	body := `{"target":"` + target + `","timeout":"5s","flow":{"credits":1},"request":{"service":"svc"}}`
+	rec := serveSSE(ws, http.MethodPost, "/api/stream/grpc.health.v1.Health/Watch", url.Values{}, body)
+
+	if n := strings.Count(rec.Body.String(), "event:message"); n != 5 {
+		t.Fatalf("%d message events, want 5: %s", n, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"codeName":"OK"`) {
+		t.Fatalf("no OK status event: %s", rec.Body)
+	}
+}
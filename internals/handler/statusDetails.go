@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	// Register the google.rpc error detail types (BadRequest, RetryInfo,
+	// ErrorInfo, QuotaFailure, ...) so status details resolve out of the box.
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// decodeStatusDetail renders a status detail as proto3 JSON with its @type.
+// Details whose type cannot be resolved keep their raw bytes, base64 encoded.
+func decodeStatusDetail(detail *anypb.Any, resolver *typeResolver) json.RawMessage {
+	opts := protojson.MarshalOptions{Resolver: resolver}
+	if data, err := opts.Marshal(detail); err == nil {
+		return data
+	}
+
+	data, _ := json.Marshal(map[string]string{
+		"@type": detail.GetTypeUrl(),
+		"value": base64.StdEncoding.EncodeToString(detail.GetValue()),
+	})
+	return data
+}
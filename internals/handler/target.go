@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+)
+
+// Load-balancing policies selectable per call
+const (
+	LBPickFirst  = "pick_first"
+	LBRoundRobin = "round_robin"
+)
+
+// Log messages as variables
+var (
+	MsgUnknownLBPolicy    = "Unknown load-balancing policy %q"
+	MsgEmptyAddressList   = "%s: target lists no addresses"
+	MsgInvalidListAddress = "%s: invalid address %q"
+)
+
+// Target schemes understood by gRPC itself. ipv4 and ipv6 are registered
+// below; dns, unix, unix-abstract and passthrough come with grpc-go.
+var targetSchemes = map[string]bool{
+	"dns":           true,
+	"unix":          true,
+	"unix-abstract": true,
+	"passthrough":   true,
+	"ipv4":          true,
+	"ipv6":          true,
+}
+
+func init() {
+	resolver.Register(&addressListBuilder{scheme: "ipv4"})
+	resolver.Register(&addressListBuilder{scheme: "ipv6"})
+}
+
+// parseSchemeTarget recognizes gRPC target URIs such as unix:///run/app.sock
+// or dns:///svc:50051, which are dialed as given. Sockets never imply TLS;
+// the other schemes imply it on port 443 like a plain host:port.
+func parseSchemeTarget(rawTarget string) (target string, useTLS bool, ok bool) {
+	scheme, _, found := strings.Cut(rawTarget, ":")
+	if !found || !targetSchemes[scheme] {
+		return "", false, false
+	}
+
+	if strings.HasPrefix(scheme, "unix") {
+		return rawTarget, false, true
+	}
+	return rawTarget, strings.HasSuffix(rawTarget, DefaultPort443), true
+}
+
+// loadBalancingOptions select the load-balancing policy through the default
+// service config, so a service config published by the resolver still wins.
+func loadBalancingOptions(policy string) ([]grpc.DialOption, error) {
+	switch policy {
+	case "":
+		return nil, nil
+	case LBPickFirst, LBRoundRobin:
+		return []grpc.DialOption{
+			grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, policy)),
+		}, nil
+	default:
+		return nil, fmt.Errorf(MsgUnknownLBPolicy, policy)
+	}
+}
+
+// peerAddress returns the backend address that served a call, if known.
+func peerAddress(p *peer.Peer) string {
+	if p == nil || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+// addressListBuilder resolves ipv4:addr:port[,addr:port...] and
+// ipv6:[addr]:port[,[addr]:port...] targets to a fixed list of backends.
+type addressListBuilder struct {
+	scheme string
+}
+
+func (b *addressListBuilder) Scheme() string {
+	return b.scheme
+}
+
+func (b *addressListBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs, err := b.parseAddresses(target.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, err
+	}
+	return addressListResolver{}, nil
+}
+
+// OverrideAuthority uses the first address, as the whole list is not a
+// valid :authority.
+func (b *addressListBuilder) OverrideAuthority(target resolver.Target) string {
+	first, _, _ := strings.Cut(target.Endpoint(), ",")
+	return first
+}
+
+func (b *addressListBuilder) parseAddresses(endpoint string) ([]resolver.Address, error) {
+	var addrs []resolver.Address
+
+	for _, entry := range strings.Split(endpoint, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		host, _, err := net.SplitHostPort(entry)
+		if err != nil {
+			return nil, fmt.Errorf(MsgInvalidListAddress, b.scheme, entry)
+		}
+
+		ip := net.ParseIP(host)
+		if ip == nil || (ip.To4() != nil) != (b.scheme == "ipv4") {
+			return nil, fmt.Errorf(MsgInvalidListAddress, b.scheme, entry)
+		}
+
+		addrs = append(addrs, resolver.Address{Addr: entry})
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf(MsgEmptyAddressList, b.scheme)
+	}
+	return addrs, nil
+}
+
+// addressListResolver has nothing to re-resolve: the list is fixed.
+type addressListResolver struct{}
+
+func (addressListResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (addressListResolver) Close() {}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// Log messages as variables
+var (
+	MsgInvalidCACert       = "tls: no certificates found in caCert PEM"
+	MsgInvalidClientCert   = "tls: invalid client certificate/key pair: %v"
+	MsgIncompleteClientKey = "tls: clientCert and clientKey must be given together"
+	MsgInvalidTLSVersion   = "tls: unsupported minVersion %q"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig describes the transport security for a target explicitly. When
+// omitted, TLS is inferred from the target (https:// or port 443) and uses
+// the system roots.
+type TLSConfig struct {
+	Enabled            *bool  `json:"enabled,omitempty"`    // defaults to true when a TLS config is given
+	CACert             string `json:"caCert,omitempty"`     // PEM bundle replacing the system roots
+	ClientCert         string `json:"clientCert,omitempty"` // PEM, for mTLS
+	ClientKey          string `json:"clientKey,omitempty"`  // PEM, for mTLS
+	ServerName         string `json:"serverName,omitempty"` // SNI and verification name override
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	MinVersion         string `json:"minVersion,omitempty"` // "1.0" to "1.3"
+}
+
+func (t *TLSConfig) enabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// buildTLSCredentials turns cfg into gRPC transport credentials.
+func buildTLSCredentials(cfg *TLSConfig) (credentials.TransportCredentials, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf(MsgInvalidTLSVersion, cfg.MinVersion)
+		}
+		tlsCfg.MinVersion = version
+	}
+
+	if cfg.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.CACert)) {
+			return nil, errors.New(MsgInvalidCACert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if (cfg.ClientCert == "") != (cfg.ClientKey == "") {
+		return nil, errors.New(MsgIncompleteClientKey)
+	}
+
+	if cfg.ClientCert != "" {
+		cert, err := tls.X509KeyPair([]byte(cfg.ClientCert), []byte(cfg.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf(MsgInvalidClientCert, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsCfg), nil
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testPKI is a CA with a server certificate for "grpc.internal" (and no IP
+// address, so dialing 127.0.0.1 needs serverName) and a client certificate.
+type testPKI struct {
+	caPEM                 string
+	server                tls.Certificate
+	clientCert, clientKey string
+	pool                  *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	caKey := newTestKey(t)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (string, string) {
+		key := newTestKey(t)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pemBlock("CERTIFICATE", der), pemBlock("EC PRIVATE KEY", keyDER)
+	}
+
+	serverCert, serverKey := issue(2, "grpc.internal", x509.ExtKeyUsageServerAuth)
+	server, err := tls.X509KeyPair([]byte(serverCert), []byte(serverKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, clientKey := issue(3, "client", x509.ExtKeyUsageClientAuth)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	return &testPKI{
+		caPEM:      pemBlock("CERTIFICATE", caDER),
+		server:     server,
+		clientCert: clientCert,
+		clientKey:  clientKey,
+		pool:       pool,
+	}
+}
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func pemBlock(typ string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+}
+
+// checkHealth dials target through dialTarget and makes one call.
+func checkHealth(target string, cfg *TLSConfig) error {
+	conn, err := dialTarget(target, cfg, "")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "svc"})
+	return err
+}
+
+func TestDialTargetTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tlsServer := func(cfg *tls.Config) string {
+		cfg.Certificates = []tls.Certificate{pki.server}
+		return startHealthServer(t, grpc.Creds(credentials.NewTLS(cfg)))
+	}
+	plain := tlsServer(&tls.Config{})
+	mutual := tlsServer(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pki.pool})
+	tls12 := tlsServer(&tls.Config{MaxVersion: tls.VersionTLS12})
+
+	tests := []struct {
+		name   string
+		target string
+		cfg    *TLSConfig
+		ok     bool
+	}{
+		{"caCert with serverName", plain, &TLSConfig{CACert: pki.caPEM, ServerName: "grpc.internal"}, true},
+		{"caCert without serverName", plain, &TLSConfig{CACert: pki.caPEM}, false},
+		{"serverName without caCert", plain, &TLSConfig{ServerName: "grpc.internal"}, false},
+		{"insecureSkipVerify", plain, &TLSConfig{InsecureSkipVerify: true}, true},
+		{"mTLS", mutual, &TLSConfig{
+			CACert:     pki.caPEM,
+			ServerName: "grpc.internal",
+			ClientCert: pki.clientCert,
+			ClientKey:  pki.clientKey,
+		}, true},
+		{"mTLS without client cert", mutual, &TLSConfig{CACert: pki.caPEM, ServerName: "grpc.internal"}, false},
+		{"minVersion met", tls12, &TLSConfig{InsecureSkipVerify: true, MinVersion: "1.2"}, true},
+		{"minVersion above server", tls12, &TLSConfig{InsecureSkipVerify: true, MinVersion: "1.3"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHealth(tt.target, tt.cfg)
+			if tt.ok && err != nil {
+				t.Fatalf("call failed: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("call succeeded, want a failed handshake")
+			}
+		})
+	}
+}
+
+func TestBuildTLSCredentialsErrors(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name string
+		cfg  *TLSConfig
+	}{
+		{"bad caCert", &TLSConfig{CACert: "not a certificate"}},
+		{"clientCert without key", &TLSConfig{ClientCert: pki.clientCert}},
+		{"mismatched key", &TLSConfig{ClientCert: pki.clientCert, ClientKey: pemBlock("EC PRIVATE KEY", []byte("x"))}},
+		{"unknown minVersion", &TLSConfig{MinVersion: "1.4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := dialTarget("127.0.0.1:1", tt.cfg, ""); err == nil {
+				t.Fatal("dialTarget succeeded, want a config error")
+			}
+		})
+	}
+}
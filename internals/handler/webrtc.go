@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+)
+
+// WebRTC configuration
+const (
+	RTCControlChannel   = "control"
+	RTCAnswerTimeout    = 30 * time.Second
+	RTCGatherTimeout    = 10 * time.Second
+	RTCInboundQueueSize = 64
+)
+
+// Log messages as variables
+var (
+	MsgCreatePeerFailed   = "Failed to create peer connection"
+	MsgCreateOfferFailed  = "Failed to create offer"
+	MsgInvalidAnswerJSON  = "Invalid answer JSON"
+	MsgRTCSessionNotFound = "RTC session not found"
+	MsgSetAnswerFailed    = "Failed to apply answer"
+	MsgICEGatherFailed    = "ICE gathering did not complete"
+	MsgRTCSessionClosed   = "RTC session closed: %s"
+)
+
+var errDataChannelClosed = errors.New("data channel closed")
+
+// RTCOfferResponse carries the server's offer; the client answers it with
+// the same ID.
+type RTCOfferResponse struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	SDP  string `json:"sdp"`
+}
+
+// RTCAnswerRequest is the client's answer to an earlier offer.
+type RTCAnswerRequest struct {
+	ID  string `json:"id"`
+	SDP string `json:"sdp"`
+}
+
+// rtcSession is a peer connection created by an offer. Every data channel
+// the client opens on it (other than the control channel) carries one call.
+type rtcSession struct {
+	id          string
+	pc          *webrtc.PeerConnection
+	workspaceID string
+	answered    chan struct{}
+}
+
+var (
+	rtcSessions   = make(map[string]*rtcSession)
+	rtcSessionsMu sync.Mutex
+)
+
+// WebRTC offer handler
+func HandleRTCOffer(c *gin.Context) {
+	session, err := newRTCSession(workspaceIDFromRequest(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": MsgCreatePeerFailed, "details": err.Error()})
+		return
+	}
+
+	offer, err := session.createOffer(c.Request.Context())
+	if err != nil {
+		session.close()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": MsgCreateOfferFailed, "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, RTCOfferResponse{ID: session.id, Type: offer.Type.String(), SDP: offer.SDP})
+}
+
+// WebRTC answer handler
+func HandleRTCAnswer(c *gin.Context) {
+	var req RTCAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgInvalidAnswerJSON})
+		return
+	}
+
+	rtcSessionsMu.Lock()
+	session, ok := rtcSessions[req.ID]
+	rtcSessionsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgRTCSessionNotFound})
+		return
+	}
+
+	answer := webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: req.SDP}
+	if err := session.pc.SetRemoteDescription(answer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": MsgSetAnswerFailed, "details": err.Error()})
+		return
+	}
+
+	select {
+	case <-session.answered:
+	default:
+		close(session.answered)
+	}
+	c.JSON(http.StatusOK, gin.H{"id": session.id})
+}
+
+func newRTCSession(workspaceID string) (*rtcSession, error) {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, err
+	}
+
+	session := &rtcSession{
+		id:          uuid.NewString(),
+		pc:          pc,
+		workspaceID: workspaceID,
+		answered:    make(chan struct{}),
+	}
+
+	pc.OnDataChannel(session.serveDataChannel)
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			session.close()
+		}
+	})
+
+	rtcSessionsMu.Lock()
+	rtcSessions[session.id] = session
+	rtcSessionsMu.Unlock()
+
+	go session.expireUnanswered()
+	return session, nil
+}
+
+// createOffer opens the control channel, so the offer negotiates SCTP and
+// the client can open per-call channels later without renegotiating, and
+// waits for ICE gathering to finish since signaling does not trickle. The
+// wait ends early if ctx is done or gathering takes over RTCGatherTimeout.
+func (s *rtcSession) createOffer(ctx context.Context) (*webrtc.SessionDescription, error) {
+	if _, err := s.pc.CreateDataChannel(RTCControlChannel, nil); err != nil {
+		return nil, err
+	}
+
+	offer, err := s.pc.CreateOffer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gathered := webrtc.GatheringCompletePromise(s.pc)
+	if err := s.pc.SetLocalDescription(offer); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RTCGatherTimeout)
+	defer cancel()
+
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %v", MsgICEGatherFailed, ctx.Err())
+	}
+
+	return s.pc.LocalDescription(), nil
+}
+
+func (s *rtcSession) serveDataChannel(dc *webrtc.DataChannel) {
+	if dc.Label() == RTCControlChannel {
+		return
+	}
+
+	conn := newDataChannelConn(dc)
+	go func() {
+		defer dc.Close()
+		serveCall(conn, s.workspaceID)
+	}()
+}
+
+func (s *rtcSession) expireUnanswered() {
+	select {
+	case <-s.answered:
+	case <-time.After(RTCAnswerTimeout):
+		s.close()
+	}
+}
+
+func (s *rtcSession) close() {
+	rtcSessionsMu.Lock()
+	_, ok := rtcSessions[s.id]
+	delete(rtcSessions, s.id)
+	rtcSessionsMu.Unlock()
+
+	if ok {
+		s.pc.Close()
+		fmt.Printf(MsgRTCSessionClosed+"\n", s.id)
+	}
+}
+
+// dataChannelConn adapts a data channel to streamConn. Inbound messages are
+// queued from pion's callback and handed out by ReadMessage.
+type dataChannelConn struct {
+	dc       *webrtc.DataChannel
+	inbound  chan webrtc.DataChannelMessage
+	closed   chan struct{}
+	closeOne sync.Once
+}
+
+func newDataChannelConn(dc *webrtc.DataChannel) *dataChannelConn {
+	conn := &dataChannelConn{
+		dc:      dc,
+		inbound: make(chan webrtc.DataChannelMessage, RTCInboundQueueSize),
+		closed:  make(chan struct{}),
+	}
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		select {
+		case conn.inbound <- msg:
+		case <-conn.closed:
+		}
+	})
+	dc.OnClose(func() {
+		conn.closeOne.Do(func() { close(conn.closed) })
+	})
+
+	return conn
+}
+
+func (c *dataChannelConn) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-c.inbound:
+		if msg.IsString {
+			return websocket.TextMessage, msg.Data, nil
+		}
+		return websocket.BinaryMessage, msg.Data, nil
+	case <-c.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+func (c *dataChannelConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-c.closed:
+		return errDataChannelClosed
+	default:
+	}
+
+	if messageType == websocket.BinaryMessage {
+		return c.dc.Send(data)
+	}
+	return c.dc.SendText(string(data))
+}
+
+func (c *dataChannelConn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pion/webrtc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const echoProto = `syntax = "proto3";
+package echo;
+
+import "google/protobuf/wrappers.proto";
+
+service Echo {
+  rpc Collect(stream google.protobuf.StringValue) returns (google.protobuf.StringValue);
+  rpc Chat(stream google.protobuf.StringValue) returns (stream google.protobuf.StringValue);
+}
+`
+
+// startEchoServer serves echo.Echo: Collect answers with its requests
+// joined by commas, and Chat echoes each request as it arrives.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "echo.Echo",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Collect",
+				ClientStreams: true,
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					var parts []string
+					for {
+						var msg wrapperspb.StringValue
+						if err := stream.RecvMsg(&msg); err == io.EOF {
+							return stream.SendMsg(wrapperspb.String(strings.Join(parts, ",")))
+						} else if err != nil {
+							return err
+						}
+						parts = append(parts, msg.Value)
+					}
+				},
+			},
+			{
+				StreamName:    "Chat",
+				ClientStreams: true,
+				ServerStreams: true,
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					for {
+						var msg wrapperspb.StringValue
+						if err := stream.RecvMsg(&msg); err == io.EOF {
+							return nil
+						} else if err != nil {
+							return err
+						}
+						if err := stream.SendMsg(&msg); err != nil {
+							return err
+						}
+					}
+				},
+			},
+		},
+	}, struct{}{})
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// rtcClient is the browser side of a WebRTC session, negotiated through the
+// HTTP signaling handlers.
+type rtcClient struct {
+	pc *webrtc.PeerConnection
+}
+
+func connectRTC(t *testing.T, workspaceID string) *rtcClient {
+	t.Helper()
+
+	router := gin.New()
+	router.POST("/rtc/offer", HandleRTCOffer)
+	router.POST("/rtc/answer", HandleRTCAnswer)
+
+	req := httptest.NewRequest(http.MethodPost, "/rtc/offer", nil)
+	req.Header.Set(WorkspaceHeader, workspaceID)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("offer: %d %s", rec.Code, rec.Body)
+	}
+
+	var offer RTCOfferResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &offer); err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	connected := make(chan struct{})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected {
+			close(connected)
+		}
+	})
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer.SDP}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+
+	body, _ := json.Marshal(RTCAnswerRequest{ID: offer.ID, SDP: pc.LocalDescription().SDP})
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rtc/answer", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("answer: %d %s", rec.Code, rec.Body)
+	}
+
+	select {
+	case <-connected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("peer connection not established")
+	}
+	return &rtcClient{pc: pc}
+}
+
+// call opens a data channel for one call, sends init and then each message
+// in turn, and returns the frames received up to and including the status.
+// onFrame may send more on the channel as frames arrive.
+func (c *rtcClient) call(t *testing.T, label string, init InitMessage, messages []string, onFrame func(*webrtc.DataChannel, *Frame)) []*Frame {
+	t.Helper()
+
+	dc, err := c.pc.CreateDataChannel(label, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := make(chan *Frame, 64)
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var frame Frame
+		if err := json.Unmarshal(msg.Data, &frame); err != nil {
+			t.Errorf("bad frame %q: %v", msg.Data, err)
+			return
+		}
+		frames <- &frame
+	})
+	dc.OnOpen(func() {
+		data, _ := json.Marshal(init)
+		dc.SendText(string(data))
+		for _, msg := range messages {
+			dc.SendText(msg)
+		}
+	})
+
+	var got []*Frame
+	for {
+		select {
+		case frame := <-frames:
+			got = append(got, frame)
+			if onFrame != nil {
+				onFrame(dc, frame)
+			}
+			if frame.Type == FrameStatus || frame.Type == FrameError {
+				return got
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: timed out after %d frames", label, len(got))
+		}
+	}
+}
+
+func frameTypes(frames []*Frame) []FrameType {
+	types := make([]FrameType, 0, len(frames))
+	for _, f := range frames {
+		types = append(types, f.Type)
+	}
+	return types
+}
+
+func TestRTCDataChannelCalls(t *testing.T) {
+	target := startHealthServer(t)
+	ws := newHealthWorkspace(t)
+	client := connectRTC(t, ws.ID)
+
+	init := InitMessage{Target: target, Service: "grpc.health.v1.Health"}
+
+	t.Run("unary", func(t *testing.T) {
+		init := init
+		init.Method = "Check"
+		frames := client.call(t, "unary", init, []string{`{"service":"svc"}`}, nil)
+
+		want := []FrameType{FrameHeader, FrameMessage, FrameTrailer, FrameStatus}
+		if got := frameTypes(frames); !slices.Equal(got, want) {
+			t.Fatalf("frames = %v, want %v", got, want)
+		}
+		if got := string(frames[1].Message); got != `{"status":"NOT_SERVING"}` {
+			t.Errorf("message = %s", got)
+		}
+		if code := frames[3].Status.Code; code != codes.OK {
+			t.Errorf("status = %v, want OK", code)
+		}
+	})
+
+	t.Run("server stream", func(t *testing.T) {
+		init := init
+		init.Method = "Watch"
+		cancelled := false
+		frames := client.call(t, "server", init, []string{`{"service":"svc"}`}, func(dc *webrtc.DataChannel, f *Frame) {
+			// Watch never ends on its own; cancel after the first update.
+			if f.Type == FrameMessage && !cancelled {
+				cancelled = true
+				dc.SendText(`{"@control":"cancel"}`)
+			}
+		})
+
+		if !cancelled {
+			t.Fatalf("no message frame: %v", frameTypes(frames))
+		}
+		if code := frames[len(frames)-1].Status.Code; code != codes.Canceled {
+			t.Errorf("status = %v, want CANCELLED", code)
+		}
+	})
+}
+
+func TestRTCDataChannelStreams(t *testing.T) {
+	target := startEchoServer(t)
+	ws := newProtoWorkspace(t, "echo.proto", echoProto)
+	client := connectRTC(t, ws.ID)
+
+	init := InitMessage{Target: target, Service: "echo.Echo"}
+	halfClose := `{"@control":"half-close"}`
+	cancel := `{"@control":"cancel"}`
+
+	messages := func(frames []*Frame) []string {
+		var got []string
+		for _, f := range frames {
+			if f.Type == FrameMessage {
+				got = append(got, string(f.Message))
+			}
+		}
+		return got
+	}
+
+	t.Run("client stream half-close", func(t *testing.T) {
+		init := init
+		init.Method = "Collect"
+		frames := client.call(t, "client-half-close", init, []string{`"a"`, `"b"`, halfClose}, nil)
+
+		want := []FrameType{FrameHeader, FrameMessage, FrameTrailer, FrameStatus}
+		if got := frameTypes(frames); !slices.Equal(got, want) {
+			t.Fatalf("frames = %v, want %v", got, want)
+		}
+		if got := messages(frames); !slices.Equal(got, []string{`"a,b"`}) {
+			t.Errorf("messages = %v", got)
+		}
+		if code := frames[3].Status.Code; code != codes.OK {
+			t.Errorf("status = %v, want OK", code)
+		}
+	})
+
+	t.Run("client stream cancel", func(t *testing.T) {
+		init := init
+		init.Method = "Collect"
+		frames := client.call(t, "client-cancel", init, []string{`"a"`, cancel}, nil)
+
+		last := frames[len(frames)-1]
+		if last.Type != FrameStatus || last.Status.Code != codes.Canceled {
+			t.Fatalf("frames = %v, want a CANCELLED status", frameTypes(frames))
+		}
+		if got := messages(frames); len(got) != 0 {
+			t.Errorf("messages = %v", got)
+		}
+	})
+
+	t.Run("bidi half-close", func(t *testing.T) {
+		init := init
+		init.Method = "Chat"
+		frames := client.call(t, "bidi-half-close", init, []string{`"a"`, `"b"`, halfClose}, nil)
+
+		if got := messages(frames); !slices.Equal(got, []string{`"a"`, `"b"`}) {
+			t.Errorf("messages = %v", got)
+		}
+		last := frames[len(frames)-1]
+		if last.Type != FrameStatus || last.Status.Code != codes.OK {
+			t.Fatalf("frames = %v, want an OK status", frameTypes(frames))
+		}
+	})
+
+	t.Run("bidi cancel", func(t *testing.T) {
+		init := init
+		init.Method = "Chat"
+		cancelled := false
+		frames := client.call(t, "bidi-cancel", init, []string{`"a"`}, func(dc *webrtc.DataChannel, f *Frame) {
+			// The echo proves the stream is open; cancel it mid-call.
+			if f.Type == FrameMessage && !cancelled {
+				cancelled = true
+				dc.SendText(cancel)
+			}
+		})
+
+		if !cancelled {
+			t.Fatalf("no message frame: %v", frameTypes(frames))
+		}
+		if code := frames[len(frames)-1].Status.Code; code != codes.Canceled {
+			t.Errorf("status = %v, want CANCELLED", code)
+		}
+	})
+}
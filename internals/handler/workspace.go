@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Workspace configuration
+const (
+	DescriptorSetFile     = "compiled.protoset"
+	WorkspaceDirEnv       = "GRPCUI_WORKSPACE_DIR"
+	WorkspaceHeader       = "X-Workspace-ID"
+	WorkspaceQueryParam   = "workspace"
+	WorkspaceCookie       = "grpcui_workspace"
+	WorkspaceIdleTTL      = 2 * time.Hour
+	WorkspaceJanitorEvery = 5 * time.Minute
+)
+
+// Log messages as variables
+var (
+	MsgWorkspaceCreated  = "Workspace created"
+	MsgWorkspaceDeleted  = "Workspace deleted"
+	MsgWorkspaceNotFound = "Workspace not found"
+	MsgWorkspaceExpired  = "Workspace expired: %s"
+)
+
+var ErrWorkspaceNotFound = errors.New("workspace not found")
+
+// Workspace isolates one session's uploaded sources, compiled protoset and
+// loaded descriptors from every other session.
+type Workspace struct {
+	ID  string
+	Dir string
+
+	mu       sync.RWMutex // Protect concurrent access
+	registry *descriptorRegistry
+	lastUsed time.Time
+}
+
+var (
+	workspaces        = make(map[string]*Workspace)
+	workspacesMu      sync.Mutex
+	workspaceJanitor  sync.Once
+	errNoWorkspaceRef = errors.New("no workspace reference")
+)
+
+// Create workspace handler
+func HandleCreateWorkspace(c *gin.Context) {
+	ws, err := createWorkspace()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": MsgCreateUploadDirFailed})
+		return
+	}
+
+	setWorkspaceCookie(c, ws)
+	c.JSON(http.StatusCreated, gin.H{"message": MsgWorkspaceCreated, "workspaceId": ws.ID})
+}
+
+// Delete workspace handler
+func HandleDeleteWorkspace(c *gin.Context) {
+	if !deleteWorkspace(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": MsgWorkspaceNotFound})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": MsgWorkspaceDeleted})
+}
+
+func createWorkspace() (*Workspace, error) {
+	id := uuid.NewString()
+	ws := &Workspace{
+		ID:       id,
+		Dir:      filepath.Join(workspaceRoot(), "workspace-"+id),
+		lastUsed: time.Now(),
+	}
+
+	if err := os.MkdirAll(ws.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	workspacesMu.Lock()
+	workspaces[id] = ws
+	workspacesMu.Unlock()
+
+	workspaceJanitor.Do(func() { go evictIdleWorkspaces() })
+	return ws, nil
+}
+
+// workspaceRoot is the directory workspaces are created in.
+func workspaceRoot() string {
+	if dir := os.Getenv(WorkspaceDirEnv); dir != "" {
+		return dir
+	}
+	return tempProtoDir
+}
+
+func lookupWorkspace(id string) (*Workspace, error) {
+	workspacesMu.Lock()
+	defer workspacesMu.Unlock()
+
+	ws, ok := workspaces[id]
+	if !ok {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	ws.lastUsed = time.Now()
+	return ws, nil
+}
+
+func deleteWorkspace(id string) bool {
+	workspacesMu.Lock()
+	ws, ok := workspaces[id]
+	delete(workspaces, id)
+	workspacesMu.Unlock()
+
+	if ok {
+		os.RemoveAll(ws.Dir)
+	}
+	return ok
+}
+
+func evictIdleWorkspaces() {
+	for range time.Tick(WorkspaceJanitorEvery) {
+		workspacesMu.Lock()
+		for id, ws := range workspaces {
+			if time.Since(ws.lastUsed) > WorkspaceIdleTTL {
+				delete(workspaces, id)
+				os.RemoveAll(ws.Dir)
+				fmt.Printf(MsgWorkspaceExpired+"\n", id)
+			}
+		}
+		workspacesMu.Unlock()
+	}
+}
+
+// workspaceIDFromRequest looks for a workspace reference in the header,
+// the query string and finally the session cookie, in that order.
+func workspaceIDFromRequest(c *gin.Context) string {
+	id, _ := workspaceRef(c)
+	return id
+}
+
+// workspaceRef is workspaceIDFromRequest, also reporting whether the
+// reference came from the session cookie.
+func workspaceRef(c *gin.Context) (string, bool) {
+	if id := c.GetHeader(WorkspaceHeader); id != "" {
+		return id, false
+	}
+	if id := c.Query(WorkspaceQueryParam); id != "" {
+		return id, false
+	}
+	if id, err := c.Cookie(WorkspaceCookie); err == nil && id != "" {
+		return id, true
+	}
+	return "", false
+}
+
+// resolveWorkspace returns the referenced workspace. A session cookie that
+// was used is reissued, so it lives as long as the workspace does.
+func resolveWorkspace(c *gin.Context) (*Workspace, error) {
+	id, fromCookie := workspaceRef(c)
+	if id == "" {
+		return nil, errNoWorkspaceRef
+	}
+
+	ws, err := lookupWorkspace(id)
+	if err == nil && fromCookie {
+		setWorkspaceCookie(c, ws)
+	}
+	return ws, err
+}
+
+// resolveOrCreateWorkspace returns the referenced workspace, or issues a new
+// one when the request carries no reference at all or only a cookie for a
+// workspace that has since expired. An unknown header or query reference
+// is still an error: the client asked for that workspace by name.
+func resolveOrCreateWorkspace(c *gin.Context) (*Workspace, error) {
+	ws, err := resolveWorkspace(c)
+
+	_, fromCookie := workspaceRef(c)
+	if errors.Is(err, errNoWorkspaceRef) || errors.Is(err, ErrWorkspaceNotFound) && fromCookie {
+		if ws, err = createWorkspace(); err == nil {
+			setWorkspaceCookie(c, ws)
+		}
+	}
+	return ws, err
+}
+
+func setWorkspaceCookie(c *gin.Context, ws *Workspace) {
+	c.SetCookie(WorkspaceCookie, ws.ID, int(WorkspaceIdleTTL.Seconds()), "/", "", false, true)
+}
+
+func (ws *Workspace) descriptorSetPath() string {
+	return filepath.Join(ws.Dir, DescriptorSetFile)
+}
+
+func (ws *Workspace) loadDescriptorSet() error {
+	data, err := os.ReadFile(ws.descriptorSetPath())
+	if err != nil {
+		return errors.New(MsgReadDescriptorFailed)
+	}
+
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &fds); err != nil {
+		return errors.New(MsgParseDescriptorFailed)
+	}
+
+	return ws.setDescriptorSet(&fds)
+}
+
+// setDescriptorSet links fds and replaces the workspace's descriptors with
+// the result, e.g. ones obtained through server reflection rather than a
+// compiled protoset. The previous descriptors are kept if linking fails.
+func (ws *Workspace) setDescriptorSet(fds *descriptorpb.FileDescriptorSet) error {
+	reg, err := newDescriptorRegistry(fds)
+	if err != nil {
+		return fmt.Errorf("%s: %v", MsgParseDescriptorFailed, err)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.registry = reg
+	return nil
+}
+
+// currentRegistry returns the linked descriptors, or nil if none are loaded.
+func (ws *Workspace) currentRegistry() *descriptorRegistry {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return ws.registry
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResolveOrCreateWorkspace(t *testing.T) {
+	live := newWorkspace(t)
+
+	tests := []struct {
+		name    string
+		header  string
+		cookie  string
+		created bool
+		cookied bool
+		err     error
+	}{
+		{"no reference", "", "", true, true, nil},
+		{"live cookie", "", live.ID, false, true, nil},
+		{"stale cookie", "", "expired", true, true, nil},
+		{"live header", live.ID, "", false, false, nil},
+		{"stale header", "expired", "", false, false, ErrWorkspaceNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set(WorkspaceHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: WorkspaceCookie, Value: tt.cookie})
+			}
+
+			ws, err := resolveOrCreateWorkspace(c)
+			if err != tt.err {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			created := ws.ID != live.ID
+			if created {
+				t.Cleanup(func() { deleteWorkspace(ws.ID) })
+			}
+			if created != tt.created {
+				t.Fatalf("created = %v, want %v", created, tt.created)
+			}
+
+			cookies := rec.Result().Cookies()
+			if cookied := len(cookies) == 1 && cookies[0].Value == ws.ID && cookies[0].MaxAge > 0; cookied != tt.cookied {
+				t.Fatalf("cookies %v, want reissued = %v", cookies, tt.cookied)
+			}
+		})
+	}
+}
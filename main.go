@@ -13,7 +13,7 @@ func main() {
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Workspace-ID")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -32,11 +32,41 @@ func main() {
 	})
 
 	// API routes
-	router.POST("/api/upload/proto", handler.HandleProtoUpload)      // Upload .proto files
-	router.GET("/api/listServices", handler.HandleListServices)      // List services/methods
-	router.GET("/grpc/ws/stream", handler.HandleGRPCWebSocketStream) // gRPC via WebSocket (all modes)
-	router.POST("/rtc/offer", handler.HandleRTCOffer)                // WebRTC offer handler
-	router.POST("/rtc/answer", handler.HandleRTCAnswer)              // WebRTC answer handler
+	router.POST("/api/workspaces", handler.HandleCreateWorkspace)       // Create an isolated workspace
+	router.DELETE("/api/workspaces/:id", handler.HandleDeleteWorkspace) // Drop a workspace
+	router.POST("/api/upload/proto", handler.HandleProtoUpload)         // Upload .proto files
+	router.POST("/api/reflection/load", handler.HandleReflectionLoad)   // Load descriptors via server reflection
+	router.GET("/api/listServices", handler.HandleListServices)         // List services/methods
+	router.POST("/api/invoke/:service/:method", handler.HandleInvoke)   // Unary call over plain HTTP/JSON
+	router.GET("/grpc/ws/stream", handler.HandleGRPCWebSocketStream)    // gRPC via WebSocket (all modes)
+	router.POST("/rtc/offer", handler.HandleRTCOffer)                   // WebRTC offer handler
+	router.POST("/rtc/answer", handler.HandleRTCAnswer)                 // WebRTC answer handler
+
+	// Schemas
+	router.GET("/api/schema", handler.HandleSchema)                        // Every service and method in the workspace
+	router.GET("/api/schema/:service/:method", handler.HandleMethodSchema) // One method with its message types
+	router.GET("/api/jsonschema/:message", handler.HandleJSONSchema)       // JSON Schema for a message type
+	router.GET("/api/example/:service/:method", handler.HandleExample)     // Example request payload
+
+	// Server-Sent Events
+	router.GET("/api/stream/:service/:method", handler.HandleSSEStream)  // Server stream as events (EventSource)
+	router.POST("/api/stream/:service/:method", handler.HandleSSEStream) // Same, with an invoke-style JSON body
+
+	// Connection pool
+	router.GET("/api/connections", handler.HandleListConnections)                    // Pooled connections and their state
+	router.POST("/api/connections/:id/reconnect", handler.HandleReconnectConnection) // Replace with a fresh connection
+	router.DELETE("/api/connections/:id", handler.HandleCloseConnection)             // Close and drop a connection
+
+	// Saved request collections
+	router.GET("/api/collections", handler.HandleListCollections)                    // Every folder and saved request
+	router.POST("/api/collections/folders", handler.HandleCreateFolder)              // Create a folder
+	router.PUT("/api/collections/folders/:id", handler.HandleUpdateFolder)           // Rename or move a folder
+	router.DELETE("/api/collections/folders/:id", handler.HandleDeleteFolder)        // Delete an empty folder
+	router.POST("/api/collections/requests", handler.HandleCreateSavedRequest)       // Save a request
+	router.GET("/api/collections/requests/:id", handler.HandleGetSavedRequest)       // Get a saved request
+	router.PUT("/api/collections/requests/:id", handler.HandleUpdateSavedRequest)    // Replace a saved request
+	router.DELETE("/api/collections/requests/:id", handler.HandleDeleteSavedRequest) // Delete a saved request
+	router.POST("/api/collections/requests/:id/run", handler.HandleRunSavedRequest)  // Run a saved request
 
 	// Start the server on port 8081
 	if err := router.Run("0.0.0.0:8081"); err != nil {